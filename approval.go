@@ -0,0 +1,289 @@
+package llamatask
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNoPendingApproval is returned when deciding on a gate that isn't
+// waiting for approval
+var ErrNoPendingApproval = errors.New("llamatask: no pending approval")
+
+// ApprovalStatus is the state of an approval request
+type ApprovalStatus int
+
+const (
+	ApprovalPending ApprovalStatus = iota
+	ApprovalApproved
+	ApprovalRejected
+	ApprovalExpired
+)
+
+// String returns the name of the status
+func (s ApprovalStatus) String() string {
+	switch s {
+	case ApprovalPending:
+		return "pending"
+	case ApprovalApproved:
+		return "approved"
+	case ApprovalRejected:
+		return "rejected"
+	case ApprovalExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// DefaultAuditSize is the number of decided requests an ApprovalGate keeps
+const DefaultAuditSize = 100
+
+// ApprovalRecord is an approval request and its decision
+type ApprovalRecord struct {
+	Status    ApprovalStatus `json:"status"`
+	Requested time.Time      `json:"requested"`
+	Decided   time.Time      `json:"decided,omitempty"`
+	// By is who approved or rejected the request
+	By     string `json:"by,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ApprovalGate is a task that runs its task only once a human approved it.
+// every execution needs its own approval: the gate opens a request, skips
+// the executions until the request is decided, then runs the task if it
+// was approved and opens a new request on the next tick.
+// the requests and the audit trail are kept in the State of the gate, in
+// the JobStore of the Runner, and the State is shared with the wrapped task
+type ApprovalGate struct {
+	task interface{}
+	// Expiry is how long a request waits for a decision, zero waits forever
+	Expiry time.Duration
+	// AuditSize is how many decided requests are kept, DefaultAuditSize if zero
+	AuditSize int
+
+	mut   sync.Mutex
+	state *State
+}
+
+// RequireApproval wraps a Task or FallibleTask in an ApprovalGate. until
+// the gate is added to a Runner its requests are kept in memory
+func RequireApproval(t interface{}, expiry time.Duration) *ApprovalGate {
+	return &ApprovalGate{task: t, Expiry: expiry, state: taskState(NewMemoryStore(), "")}
+}
+
+// Name returns the name of the wrapped task
+func (g *ApprovalGate) Name() string {
+	return taskName(g.task)
+}
+
+// UseState keeps the requests in s, and gives s to the wrapped task if it's
+// a StatefulTask
+func (g *ApprovalGate) UseState(s *State) {
+	g.mut.Lock()
+	g.state = &State{store: s.store, prefix: s.prefix + "approval/"}
+	g.mut.Unlock()
+	if t, ok := g.task.(stateUser); ok {
+		t.UseState(s)
+	}
+}
+
+// Guards returns the guards of the wrapped task
+func (g *ApprovalGate) Guards() []Guard {
+	if t, ok := g.task.(guarder); ok {
+		return t.Guards()
+	}
+	return nil
+}
+
+// Initialize initializes the wrapped task if it has an initializer
+func (g *ApprovalGate) Initialize() {
+	if t, ok := g.task.(initializer); ok {
+		t.Initialize()
+	}
+}
+
+// Teardown tears down the wrapped task if it has a teardown
+func (g *ApprovalGate) Teardown() {
+	if t, ok := g.task.(teardowner); ok {
+		t.Teardown()
+	}
+}
+
+// Run runs the wrapped task if the pending request was approved
+func (g *ApprovalGate) Run() error {
+	return g.runWrapped(context.Background(), time.Now())
+}
+
+// runWrapped runs the wrapped task for the tick at scheduled if the
+// pending request was approved, the Runner calls it instead of Run
+func (g *ApprovalGate) runWrapped(ctx context.Context, scheduled time.Time) error {
+	record, err := g.next(time.Now())
+	if err != nil {
+		return err
+	}
+	switch {
+	case record == nil:
+		return Skip("waiting for approval")
+	case record.Status == ApprovalRejected:
+		return Skip("rejected by " + record.By)
+	case record.Status == ApprovalExpired:
+		return Skip("approval expired")
+	}
+	return runTask(ctx, g.task, scheduled)
+}
+
+// next opens a request if there's none, or closes the decided one and
+// returns it
+func (g *ApprovalGate) next(now time.Time) (*ApprovalRecord, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	record, err := g.pending(now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, g.setPending(ApprovalRecord{Status: ApprovalPending, Requested: now})
+	}
+	if record.Status == ApprovalPending {
+		return nil, nil
+	}
+	// a crash in between audits the request twice rather than never
+	if err := g.appendAudit(*record); err != nil {
+		return nil, err
+	}
+	return record, g.state.Delete("pending")
+}
+
+// Approve approves the pending request, the task runs on the next tick
+func (g *ApprovalGate) Approve(by string) error {
+	return g.decide(ApprovalApproved, by, "")
+}
+
+// Reject rejects the pending request, the execution is skipped
+func (g *ApprovalGate) Reject(by, reason string) error {
+	return g.decide(ApprovalRejected, by, reason)
+}
+
+func (g *ApprovalGate) decide(status ApprovalStatus, by, reason string) error {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	now := time.Now()
+	record, err := g.pending(now)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Status != ApprovalPending {
+		return ErrNoPendingApproval
+	}
+	record.Status, record.Decided = status, now
+	record.By, record.Reason = by, reason
+	return g.setPending(*record)
+}
+
+// pending returns the current request, marked as expired once Expiry
+// passed, or nil. the caller must hold g.mut
+func (g *ApprovalGate) pending(now time.Time) (*ApprovalRecord, error) {
+	value, ok, err := g.state.Get("pending")
+	if err != nil || !ok {
+		return nil, err
+	}
+	var record ApprovalRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+	if record.Status == ApprovalPending && g.Expiry > 0 && now.Sub(record.Requested) >= g.Expiry {
+		record.Status, record.Decided = ApprovalExpired, record.Requested.Add(g.Expiry)
+	}
+	return &record, nil
+}
+
+func (g *ApprovalGate) setPending(record ApprovalRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return g.state.Set("pending", value)
+}
+
+// appendAudit adds a decided request to the audit trail and drops the
+// ones beyond AuditSize, the caller must hold g.mut
+func (g *ApprovalGate) appendAudit(record ApprovalRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	next, err := g.auditNext()
+	if err != nil {
+		return err
+	}
+	if err := g.state.Set("audit/"+strconv.Itoa(next), value); err != nil {
+		return err
+	}
+	if err := g.state.Set("audit/next", []byte(strconv.Itoa(next+1))); err != nil {
+		return err
+	}
+	if dropped := next - g.auditSize(); dropped >= 0 {
+		return g.state.Delete("audit/" + strconv.Itoa(dropped))
+	}
+	return nil
+}
+
+// auditNext returns the sequence number of the next audited request
+func (g *ApprovalGate) auditNext() (int, error) {
+	value, ok, err := g.state.Get("audit/next")
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.Atoi(string(value))
+}
+
+func (g *ApprovalGate) auditSize() int {
+	if g.AuditSize <= 0 {
+		return DefaultAuditSize
+	}
+	return g.AuditSize
+}
+
+// Pending returns the request waiting for a decision, if any
+func (g *ApprovalGate) Pending() (ApprovalRecord, bool, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	record, err := g.pending(time.Now())
+	if err != nil || record == nil || record.Status != ApprovalPending {
+		return ApprovalRecord{}, false, err
+	}
+	return *record, true, nil
+}
+
+// Audit returns the last decided requests, oldest first
+func (g *ApprovalGate) Audit() ([]ApprovalRecord, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	next, err := g.auditNext()
+	if err != nil {
+		return nil, err
+	}
+	first := next - g.auditSize()
+	if first < 0 {
+		first = 0
+	}
+	var audit []ApprovalRecord
+	for i := first; i < next; i++ {
+		value, ok, err := g.state.Get("audit/" + strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		var record ApprovalRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, err
+		}
+		audit = append(audit, record)
+	}
+	return audit, nil
+}
@@ -0,0 +1,145 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApprovalGateWorkflow(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	deployed := false
+	wf := NewWorkflow("deploy", Do(func() error { deployed = true; return nil }))
+	gate := RequireApproval(wf, 0)
+	r.AddTask(gate)
+
+	r.tick(time.Now())
+	if e := r.History()[0]; e.Outcome != OutcomeSkipped || e.Reason != "waiting for approval" {
+		t.Fatalf("got %s execution (%s), want it to wait for approval", e.Outcome, e.Reason)
+	}
+	if err := gate.Approve("alice"); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if done, err := wf.Done(); !done || !deployed {
+		t.Errorf("the approved workflow didn't run: %v", err)
+	}
+}
+
+// guardedScheduledTask is a ScheduledTask with its own guard
+type guardedScheduledTask struct {
+	scheduledTask
+	allowed bool
+}
+
+func (t *guardedScheduledTask) Name() string { return "backup" }
+
+func (t *guardedScheduledTask) Guards() []Guard {
+	return []Guard{GuardFunc(func(context.Context) (bool, string) { return t.allowed, "maintenance window" })}
+}
+
+// contextCheckTask reports whether it got a cancellable context
+type contextCheckTask struct{ cancellable bool }
+
+func (t *contextCheckTask) Run() error { return nil }
+
+func (t *contextCheckTask) RunContext(ctx context.Context) error {
+	t.cancellable = ctx.Done() != nil
+	return nil
+}
+
+func TestApprovalGateForwards(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &guardedScheduledTask{}
+	gate := RequireApproval(task, 0)
+	r.AddTask(gate)
+
+	r.tick(time.Now())
+	if _, pending, _ := gate.Pending(); pending {
+		t.Error("a request was opened although the guard of the task failed")
+	}
+	task.allowed = true
+	r.tick(time.Now())
+	gate.Approve("alice")
+	tick := time.Now()
+	r.tick(tick)
+	if len(task.scheduled) != 1 || !task.scheduled[0].Equal(tick) {
+		t.Errorf("the task ran for %v, want the tick %v", task.scheduled, tick)
+	}
+
+	ctxTask := &contextCheckTask{}
+	ctxGate := RequireApproval(ctxTask, 0)
+	r.AddTask(ctxGate)
+	r.tick(time.Now())
+	ctxGate.Approve("alice")
+	r.tick(time.Now())
+	if !ctxTask.cancellable {
+		t.Error("the ContextTask didn't get the context of the Runner")
+	}
+}
+
+func TestApprovalGatePersists(t *testing.T) {
+	store := NewMemoryStore()
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetJobStore(store)
+	r.AddTask(RequireApproval(&guardedScheduledTask{allowed: true}, 0))
+	r.tick(time.Now())
+
+	// the request survives a restart
+	restarted, _ := newTestRunner(time.Minute, false)
+	restarted.SetJobStore(store)
+	task := &guardedScheduledTask{allowed: true}
+	gate := RequireApproval(task, 0)
+	restarted.AddTask(gate)
+	if _, pending, err := gate.Pending(); !pending || err != nil {
+		t.Fatalf("the request was lost: %v", err)
+	}
+	gate.Reject("bob", "freeze")
+	restarted.tick(time.Now())
+	if len(task.scheduled) != 0 {
+		t.Error("the rejected task ran")
+	}
+	if e := restarted.History()[0]; e.Reason != "rejected by bob" {
+		t.Errorf("got skip reason %q", e.Reason)
+	}
+
+	audit, err := gate.Audit()
+	if err != nil || len(audit) != 1 || audit[0].Status != ApprovalRejected || audit[0].Reason != "freeze" {
+		t.Errorf("got audit %+v, %v", audit, err)
+	}
+}
+
+func TestApprovalGateAuditSize(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	gate := RequireApproval(&countTask{}, 0)
+	gate.AuditSize = 2
+	r.AddTask(gate)
+
+	for _, by := range []string{"alice", "bob", "carol"} {
+		r.tick(time.Now())
+		gate.Reject(by, "")
+		r.tick(time.Now())
+	}
+	audit, err := gate.Audit()
+	if err != nil || len(audit) != 2 || audit[0].By != "bob" || audit[1].By != "carol" {
+		t.Errorf("got audit %+v, %v; want the last 2 decisions", audit, err)
+	}
+}
+
+func TestApprovalGateExpiry(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	gate := RequireApproval(&countTask{}, time.Nanosecond)
+	r.AddTask(gate)
+
+	r.tick(time.Now())
+	time.Sleep(time.Millisecond)
+	if err := gate.Approve("alice"); !errors.Is(err, ErrNoPendingApproval) {
+		t.Errorf("approving an expired request: got %v", err)
+	}
+	r.tick(time.Now())
+	audit, _ := gate.Audit()
+	if len(audit) != 1 || audit[0].Status != ApprovalExpired {
+		t.Errorf("got audit %+v, want the expired request", audit)
+	}
+}
@@ -0,0 +1,34 @@
+package llamatask
+
+import "time"
+
+// SetTickBudget sets how long the tasks may run on a single tick in
+// synchronous mode. once the budget is spent the remaining tasks are
+// deferred to the next tick, which starts with them, and an EventOverrun is
+// emitted. zero (the default) disables the budget
+func (r *Runner) SetTickBudget(d time.Duration) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.budget = d
+}
+
+// runTasksWithBudget runs the tasks in order starting from r.cursor until
+// r.budget is spent, the caller must hold r.mut
+func (r *Runner) runTasksWithBudget(scheduled time.Time) {
+	n := len(r.tasks)
+	if r.cursor >= n {
+		r.cursor = 0
+	}
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		// always run at least one task so every task eventually runs
+		if i > 0 && time.Since(start) >= r.budget {
+			r.cursor = (r.cursor + i) % n
+			r.deferred = n - i
+			r.emit(Event{Kind: EventOverrun, Time: time.Now(), Deferred: n - i})
+			return
+		}
+		r.executeSync(r.tasks[(r.cursor+i)%n], scheduled)
+	}
+	r.deferred = 0
+}
@@ -0,0 +1,95 @@
+package llamatask
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sleepTask logs its name and sleeps for d
+type sleepTask struct {
+	name string
+	d    time.Duration
+	mut  *sync.Mutex
+	log  *[]string
+}
+
+func (t *sleepTask) Name() string { return t.name }
+
+func (t *sleepTask) Run() {
+	t.mut.Lock()
+	*t.log = append(*t.log, t.name)
+	t.mut.Unlock()
+	time.Sleep(t.d)
+}
+
+// newBudgetRunner returns a Runner with a tick budget of a bit more than
+// one of its tasks, and a function returning and clearing the log of runs
+func newBudgetRunner(names ...string) (*Runner, []*TaskHandle, func() string) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetTickBudget(30 * time.Millisecond)
+	var mut sync.Mutex
+	var log []string
+	handles := make([]*TaskHandle, len(names))
+	for i, name := range names {
+		handles[i] = r.AddTask(&sleepTask{name: name, d: 20 * time.Millisecond, mut: &mut, log: &log})
+	}
+	return r, handles, func() string {
+		mut.Lock()
+		defer mut.Unlock()
+		runs := strings.Join(log, " ")
+		log = nil
+		return runs
+	}
+}
+
+func TestTickBudgetDefers(t *testing.T) {
+	r, _, runs := newBudgetRunner("a", "b", "c", "d")
+	events := recordEvents(r)
+
+	r.tick(time.Now())
+	if got := runs(); got != "a b" {
+		t.Errorf("first tick ran %q, want the tasks within the budget", got)
+	}
+	if overruns := events.kind(EventOverrun); len(overruns) != 1 || overruns[0].Deferred != 2 {
+		t.Errorf("got overruns %+v, want 2 tasks deferred", overruns)
+	}
+
+	// the deferred tasks go first
+	r.tick(time.Now())
+	if got := runs(); got != "c d" {
+		t.Errorf("second tick ran %q, want the deferred tasks", got)
+	}
+	r.tick(time.Now())
+	if got := runs(); got != "a b" {
+		t.Errorf("third tick ran %q, want the order to rotate", got)
+	}
+	if overruns := events.kind(EventOverrun); len(overruns) != 3 {
+		t.Errorf("got %d overruns, want one per tick", len(overruns))
+	}
+}
+
+func TestTickBudgetRemoveTask(t *testing.T) {
+	r, handles, runs := newBudgetRunner("a", "b", "c", "d")
+	r.tick(time.Now())
+	runs()
+
+	// removing a task that already ran keeps the deferred ones first
+	if err := r.RemoveTask(handles[0]); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if got := runs(); got != "c d" {
+		t.Errorf("ran %q after the removal, want the deferred tasks", got)
+	}
+
+	// b is deferred now, the tick after its removal starts with the next task
+	if err := r.RemoveTask(handles[1]); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if got := runs(); got != "c d" {
+		t.Errorf("ran %q after removing the deferred task, want the next ones", got)
+	}
+}
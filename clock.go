@@ -0,0 +1,80 @@
+package llamatask
+
+import "time"
+
+// DefaultClockJumpThreshold is the divergence between wall and monotonic
+// clock that is considered a clock jump
+const DefaultClockJumpThreshold = time.Second
+
+// MisfirePolicy decides what a Runner does with ticks that were missed
+// because the host was suspended or the wall clock jumped forward
+type MisfirePolicy int
+
+const (
+	// MisfireSkip ignores the missed ticks, the tasks run again one interval
+	// after the jump. tasks that follow the wall clock are rescheduled from
+	// the current time, dropping the runs they missed
+	MisfireSkip MisfirePolicy = iota
+	// MisfireRunOnce runs the tasks once right away to catch up
+	MisfireRunOnce
+)
+
+// RescheduledTask is a Task that follows the wall clock, like SolarTask.
+// Reschedule is called after a forward clock jump with MisfireSkip so it
+// can recompute its next run from now
+type RescheduledTask interface {
+	Task
+	Reschedule(now time.Time)
+}
+
+// SetClockJumpThreshold sets how much the wall clock may drift from the
+// monotonic clock between two ticks before it's reported as a clock jump
+func (r *Runner) SetClockJumpThreshold(d time.Duration) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.jumpThreshold = d
+}
+
+// SetMisfirePolicy sets the policy applied after a forward clock jump
+func (r *Runner) SetMisfirePolicy(p MisfirePolicy) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.misfire = p
+}
+
+// monotonicElapsed is the monotonic time between two ticks, time.Time.Sub
+// uses the monotonic clock readings when both times have one
+func monotonicElapsed(last, now time.Time) time.Duration {
+	return now.Sub(last)
+}
+
+// checkClock compares the wall and monotonic time elapsed since the previous
+// tick. time.Ticker only follows the monotonic clock, so a suspend or a clock
+// change shows up as a difference between the two. it reports whether the
+// tasks should run on this tick, a forward jump over an interval is only
+// caught up with MisfireRunOnce.
+// the caller must hold r.mut
+func (r *Runner) checkClock(now time.Time) bool {
+	last := r.lastTick
+	r.lastTick = now
+	if last.IsZero() {
+		return true
+	}
+	drift := now.Round(0).Sub(last.Round(0)) - r.elapsed(last, now)
+	if drift.Abs() < r.jumpThreshold {
+		return true
+	}
+
+	// restart the ticker so the next tick is a full interval from now
+	r.ticker.Reset(r.interval)
+	r.emit(Event{Kind: EventClockJump, Time: now, Drift: drift})
+	if drift < r.interval || r.misfire == MisfireRunOnce {
+		return true
+	}
+	for _, h := range r.tasks {
+		if t, ok := h.task.(rescheduler); ok {
+			t.Reschedule(now)
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package llamatask
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var clockBase = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestClockJumpDetection(t *testing.T) {
+	r, ticker := newTestRunner(time.Minute, false)
+	events := recordEvents(r)
+	r.tick(clockBase)
+	r.tick(clockBase.Add(time.Minute))
+	r.tick(clockBase.Add(2*time.Minute + 500*time.Millisecond)) // under the threshold
+	if got := events.kind(EventClockJump); len(got) != 0 {
+		t.Fatalf("got %d clock jumps before any jump, want 0", len(got))
+	}
+
+	r.tick(clockBase.Add(2 * time.Hour))
+	got := events.kind(EventClockJump)
+	if len(got) != 1 {
+		t.Fatalf("got %d clock jumps, want 1", len(got))
+	}
+	if want := 2*time.Hour - 2*time.Minute - 500*time.Millisecond - time.Minute; got[0].Drift != want {
+		t.Errorf("drift = %s, want %s", got[0].Drift, want)
+	}
+	if resets := atomic.LoadInt32(&ticker.resets); resets != 1 {
+		t.Errorf("ticker was reset %d times, want 1", resets)
+	}
+}
+
+func TestClockJumpThreshold(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetClockJumpThreshold(time.Hour)
+	events := recordEvents(r)
+	r.tick(clockBase)
+	r.tick(clockBase.Add(30 * time.Minute))
+	if got := events.kind(EventClockJump); len(got) != 0 {
+		t.Fatalf("got %d clock jumps under the threshold, want 0", len(got))
+	}
+}
+
+func TestMisfirePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  MisfirePolicy
+		paused  bool
+		jump    time.Duration
+		wantRun int
+	}{
+		{"skip", MisfireSkip, false, time.Hour, 0},
+		{"run once", MisfireRunOnce, false, time.Hour, 1},
+		{"run once paused", MisfireRunOnce, true, time.Hour, 0},
+		{"small jump", MisfireSkip, false, 30 * time.Second, 1},
+		{"backward jump", MisfireSkip, false, -time.Hour, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRunner(time.Minute, false)
+			r.SetClockJumpThreshold(10 * time.Second)
+			r.SetMisfirePolicy(test.policy)
+			task := &countTask{}
+			r.AddTask(task)
+			r.tick(clockBase)
+			if test.paused {
+				r.Pause()
+			}
+			before := task.count()
+			r.tick(clockBase.Add(time.Minute + test.jump))
+			if got := task.count() - before; got != test.wantRun {
+				t.Errorf("tasks ran %d times on the jump tick, want %d", got, test.wantRun)
+			}
+		})
+	}
+}
+
+func TestMisfireSkipReschedules(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &rescheduledTask{}
+	r.AddTask(task)
+	r.tick(clockBase)
+	jumped := clockBase.Add(24 * time.Hour)
+	r.tick(jumped)
+	if !task.rescheduled.Equal(jumped) {
+		t.Errorf("rescheduled at %s, want %s", task.rescheduled, jumped)
+	}
+}
+
+type rescheduledTask struct {
+	countTask
+	rescheduled time.Time
+}
+
+func (t *rescheduledTask) Reschedule(now time.Time) { t.rescheduled = now }
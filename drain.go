@@ -0,0 +1,92 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrDraining is returned by Replay when the Runner is drained
+var ErrDraining = errors.New("llamatask: runner is drained")
+
+// DrainReport describes the work affected by a drain
+type DrainReport struct {
+	// InFlight is the number of executions that were running when the
+	// drain started and had to be waited for
+	InFlight int
+	// Deferred are the tasks that were deferred by the tick budget and
+	// won't run until the Runner is resumed
+	Deferred []*TaskHandle
+}
+
+// Drain stops dispatching new executions on the Runner and its child
+// runners, then waits for the executions in flight to finish or for ctx to
+// be done. the Runner stays drained until Resume is called, even when ctx
+// is done first: the executions in flight are then left to finish in the
+// background and the report only has InFlight
+func (r *Runner) Drain(ctx context.Context) (DrainReport, error) {
+	runners := r.tree()
+	var report DrainReport
+	for _, runner := range runners {
+		runner.dispatchMut.Lock()
+		runner.draining.Store(true)
+		report.InFlight += int(atomic.LoadInt64(&runner.inFlightCount))
+		runner.dispatchMut.Unlock()
+	}
+
+	done := make(chan []*TaskHandle, 1)
+	go func() {
+		var deferred []*TaskHandle
+		for _, runner := range runners {
+			runner.mut.Lock() // waits for the current iteration of the loop
+			for i := 0; i < runner.deferred; i++ {
+				deferred = append(deferred, runner.tasks[(runner.cursor+i)%len(runner.tasks)])
+			}
+			runner.mut.Unlock()
+			runner.inFlight.Wait()
+		}
+		done <- deferred
+	}()
+
+	select {
+	case report.Deferred = <-done:
+		return report, nil
+	case <-ctx.Done():
+		return report, ctx.Err()
+	}
+}
+
+// Draining reports whether the Runner is drained
+func (r *Runner) Draining() bool {
+	return r.draining.Load()
+}
+
+// tree returns the Runner and all its descendants, parents first
+func (r *Runner) tree() []*Runner {
+	nesting.Lock()
+	defer nesting.Unlock()
+	runners := []*Runner{r}
+	for i := 0; i < len(runners); i++ {
+		runners = append(runners, runners[i].children...)
+	}
+	return runners
+}
+
+// beginDispatch tracks an execution started outside of the loop, like by
+// Trigger or Replay, so Drain waits for it. it returns false if the Runner
+// is drained, endDispatch must be called once the execution is over
+func (r *Runner) beginDispatch() bool {
+	r.dispatchMut.Lock()
+	defer r.dispatchMut.Unlock()
+	if r.draining.Load() {
+		return false
+	}
+	r.inFlight.Add(1)
+	atomic.AddInt64(&r.inFlightCount, 1)
+	return true
+}
+
+func (r *Runner) endDispatch() {
+	atomic.AddInt64(&r.inFlightCount, -1)
+	r.inFlight.Done()
+}
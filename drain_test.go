@@ -0,0 +1,108 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingTask blocks in Run until release is closed
+type blockingTask struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingTask() *blockingTask {
+	return &blockingTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (t *blockingTask) Run() {
+	select {
+	case t.started <- struct{}{}:
+	default:
+	}
+	<-t.release
+}
+
+func TestDrainWaitsForInFlight(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	task := newBlockingTask()
+	r.AddTask(task)
+	r.tick(time.Now())
+	<-task.started
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(task.release)
+	}()
+	report, err := r.Drain(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.InFlight != 1 {
+		t.Errorf("InFlight = %d, want 1", report.InFlight)
+	}
+	if !r.Draining() {
+		t.Errorf("the runner isn't drained")
+	}
+}
+
+func TestDrainTimeoutDrainsChildren(t *testing.T) {
+	parent, _ := newTestRunner(time.Minute, true)
+	child, _ := newTestRunner(time.Minute, false)
+	task := newBlockingTask()
+	defer close(task.release)
+	childTask := &countTask{}
+	child.AddTask(childTask)
+	parent.AddTask(task)
+	parent.AddTask(child)
+	parent.tick(time.Now())
+	<-task.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := parent.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if !parent.Draining() || !child.Draining() {
+		t.Fatalf("draining: parent %v, child %v, want both", parent.Draining(), child.Draining())
+	}
+	child.tick(time.Now())
+	if childTask.count() != 0 {
+		t.Errorf("the child dispatched while drained")
+	}
+
+	parent.Resume()
+	if parent.Draining() || child.Draining() {
+		t.Errorf("Resume didn't resume the tree")
+	}
+}
+
+func TestDrainBlocksTriggerAndReplay(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	events := recordEvents(r)
+	task := &countTask{}
+	h := r.AddTask(task)
+	h.Trigger()
+	id := r.History()[0].ID
+	if _, err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Trigger()
+	if task.count() != 1 {
+		t.Errorf("Trigger ran the task of a drained runner")
+	}
+	if skips := events.kind(EventSkip); len(skips) != 1 || skips[0].Reason != "draining" {
+		t.Errorf("skip events = %+v, want one for draining", skips)
+	}
+	if _, err := r.Replay(id); !errors.Is(err, ErrDraining) {
+		t.Errorf("Replay: got %v, want ErrDraining", err)
+	}
+
+	r.Resume()
+	if _, err := r.Replay(id); err != nil || task.count() != 2 {
+		t.Errorf("Replay after Resume: %v, %d runs", err, task.count())
+	}
+}
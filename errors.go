@@ -0,0 +1,112 @@
+package llamatask
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string { return "skipped: " + e.reason }
+
+// Permanent marks err as permanent, the execution isn't retried and the
+// task is dead-lettered: it's not run anymore until Revive is called
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Transient marks err as transient, the execution is retried up to the
+// count set with SetRetries. errors that aren't marked aren't retried
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err}
+}
+
+// Skip is returned by a FallibleTask that had nothing to do, the execution
+// is recorded as skipped instead of failed
+func Skip(reason string) error {
+	return &skipError{reason}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// isRetryable reports whether an execution that failed with err can be
+// retried, only errors marked with Transient are
+func isRetryable(err error) bool {
+	var transient *transientError
+	return !IsPermanent(err) && errors.As(err, &transient)
+}
+
+// SetRetries sets how many times a failed execution is retried right away,
+// only the errors marked with Transient are retried
+func (r *Runner) SetRetries(n int) {
+	atomic.StoreInt64(&r.retries, int64(n))
+}
+
+// Stats counts the executions of a task by outcome
+type Stats struct {
+	Executions int
+	Completed  int
+	Failed     int
+	Skipped    int
+}
+
+// Stats returns the execution counters of the task
+func (h *TaskHandle) Stats() Stats {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return h.stats
+}
+
+// DeadLetter returns the permanent error that dead-lettered the task, or nil
+func (h *TaskHandle) DeadLetter() error {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	return h.deadLetter
+}
+
+// Revive runs a dead-lettered task again
+func (h *TaskHandle) Revive() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.deadLetter = nil
+}
+
+func (h *TaskHandle) count(o Outcome) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.stats.Executions++
+	switch o {
+	case OutcomeCompleted:
+		h.stats.Completed++
+	case OutcomeFailed:
+		h.stats.Failed++
+	case OutcomeSkipped:
+		h.stats.Skipped++
+	}
+}
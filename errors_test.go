@@ -0,0 +1,91 @@
+package llamatask
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	for _, c := range []struct {
+		err  error
+		want bool
+	}{
+		{errTimeout, false},
+		{Transient(errTimeout), true},
+		{fmt.Errorf("fetching: %w", Transient(errTimeout)), true},
+		{Permanent(errTimeout), false},
+		{Permanent(Transient(errTimeout)), false},
+		{Transient(Permanent(errTimeout)), false},
+		{Skip("nothing to do"), false},
+	} {
+		if got := isRetryable(c.err); got != c.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+	if Permanent(nil) != nil || Transient(nil) != nil {
+		t.Error("marking a nil error didn't return nil")
+	}
+}
+
+func TestRetriesTransientOnly(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	for _, c := range []struct {
+		err      error
+		attempts int
+	}{
+		{errTimeout, 1},
+		{Transient(errTimeout), 3},
+		{Permanent(errTimeout), 1},
+	} {
+		r, _ := newTestRunner(time.Minute, false)
+		r.SetRetries(2)
+		task := &fallibleCountTask{err: c.err}
+		r.AddTask(task)
+		r.tick(time.Now())
+		if e := r.History()[0]; e.Attempts != c.attempts || task.count() != c.attempts || !errors.Is(e.Err, errTimeout) {
+			t.Errorf("%v: got %d attempts with %v, want %d", c.err, e.Attempts, e.Err, c.attempts)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &fallibleCountTask{}
+	h := r.AddTask(task)
+	for _, err := range []error{nil, errors.New("failed"), Skip("nothing to do"), nil} {
+		task.err = err
+		r.tick(time.Now())
+	}
+	if stats := h.Stats(); stats != (Stats{Executions: 4, Completed: 2, Failed: 1, Skipped: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	if e := r.History()[2]; e.Outcome != OutcomeSkipped || e.Reason != "nothing to do" || e.Err != nil {
+		t.Errorf("got %s execution (%q, %v), want the skip reason", e.Outcome, e.Reason, e.Err)
+	}
+}
+
+func TestDeadLetterRevive(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	errInvalid := errors.New("invalid")
+	task := &fallibleCountTask{err: Permanent(errInvalid)}
+	h := r.AddTask(task)
+
+	r.tick(time.Now())
+	r.tick(time.Now())
+	if err := h.DeadLetter(); !errors.Is(err, errInvalid) || task.count() != 1 {
+		t.Fatalf("got dead letter %v after %d runs, want the task stopped", err, task.count())
+	}
+	if stats := h.Stats(); stats.Failed != 1 || stats.Executions != 1 {
+		t.Errorf("stats = %+v, the dead-lettered tick was counted", stats)
+	}
+
+	task.err = nil
+	h.Revive()
+	r.tick(time.Now())
+	if h.DeadLetter() != nil || task.count() != 2 {
+		t.Error("the revived task didn't run")
+	}
+}
@@ -0,0 +1,83 @@
+package llamatask
+
+import "time"
+
+// EventKind identifies what happened in an Event
+type EventKind int
+
+const (
+	// EventClockJump is emitted when the wall clock diverged from the
+	// monotonic clock between two ticks (clock change, suspend, VM pause)
+	EventClockJump EventKind = iota
+	// EventOverrun is emitted when a tick went over the tick budget and
+	// some tasks were deferred to the next tick
+	EventOverrun
+	// EventSkip is emitted when an execution of a task was skipped
+	EventSkip
+	// EventFailure is emitted when an execution failed
+	EventFailure
+	// EventDeadLetter is emitted when an execution failed with a permanent
+	// error, the task isn't run anymore
+	EventDeadLetter
+	// EventQuarantine is emitted when a task is quarantined after crashing
+	// too many times
+	EventQuarantine
+)
+
+// String returns the name of the event kind
+func (k EventKind) String() string {
+	switch k {
+	case EventClockJump:
+		return "clock-jump"
+	case EventOverrun:
+		return "overrun"
+	case EventSkip:
+		return "skip"
+	case EventFailure:
+		return "failure"
+	case EventDeadLetter:
+		return "dead-letter"
+	case EventQuarantine:
+		return "quarantine"
+	}
+	return "unknown"
+}
+
+// Event describes something notable that happened in a Runner
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// Task is the task the event is about, if any
+	Task *TaskHandle
+	// Reason explains why an execution was skipped (only set for EventSkip)
+	Reason string
+	// Err is the error of the failed execution
+	// (only set for EventFailure, EventDeadLetter and EventQuarantine)
+	Err error
+	// Drift is how far the wall clock moved compared to the monotonic clock
+	// (only set for EventClockJump)
+	Drift time.Duration
+	// Deferred is the number of tasks deferred to the next tick
+	// (only set for EventOverrun)
+	Deferred int
+}
+
+// OnEvent registers fn to be called for every event emitted by the Runner.
+// NOTE: handlers are called synchronously from the goroutine running the
+//
+//	tasks, they should return quickly and must not call back into the Runner
+func (r *Runner) OnEvent(fn func(Event)) {
+	r.evMut.Lock()
+	defer r.evMut.Unlock()
+	r.handlers = append(r.handlers, fn)
+}
+
+// emit calls every registered handler with e
+func (r *Runner) emit(e Event) {
+	r.evMut.Lock()
+	handlers := r.handlers
+	r.evMut.Unlock()
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
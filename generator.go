@@ -0,0 +1,143 @@
+package llamatask
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Generator is a task that regenerates the desired set of its child tasks
+// and reconciles it like a controller loop: new children are initialized
+// and added to the Runner, stale ones are removed from it and torn down.
+// the children are tasks of their own, named after the generator and
+// their ID, they run on the ticks following the reconciliation
+type Generator struct {
+	name     string
+	generate func(ctx context.Context) (map[string]interface{}, error)
+	// Interval is how often the set is regenerated, zero regenerates it on
+	// every tick
+	Interval time.Duration
+	// OnError is called when a child can't be added, it's tried again on
+	// the next reconciliation. errors of generate fail the execution
+	OnError func(id string, err error)
+
+	mut         sync.Mutex
+	runner      *Runner
+	reconciling bool
+	generated   time.Time
+	children    map[string]*TaskHandle
+}
+
+// NewGenerator creates a Generator, generate returns the desired children
+// (Task or FallibleTask) by ID. a child whose ID is already present is kept
+// as is
+func NewGenerator(name string, generate func(ctx context.Context) (map[string]interface{}, error)) *Generator {
+	return &Generator{name: name, generate: generate, children: map[string]*TaskHandle{}}
+}
+
+// Name returns the name of the generator
+func (g *Generator) Name() string {
+	return g.name
+}
+
+// useRunner is called when the generator is added to r
+func (g *Generator) useRunner(r *Runner) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.runner = r
+}
+
+// Teardown removes every child from the Runner
+func (g *Generator) Teardown() {
+	g.mut.Lock()
+	r, children := g.runner, g.children
+	g.children = map[string]*TaskHandle{}
+	g.mut.Unlock()
+	for _, h := range children {
+		r.RemoveTask(h)
+	}
+}
+
+// Run regenerates the children, it's used when the Generator is run
+// outside of a Runner
+func (g *Generator) Run() error {
+	return g.RunContext(context.Background())
+}
+
+// RunContext regenerates the children if the interval passed, they're
+// reconciled in the background: in synchronous mode the Runner is busy with
+// the current tick until this returns
+func (g *Generator) RunContext(ctx context.Context) error {
+	g.mut.Lock()
+	due := g.generated.IsZero() || time.Since(g.generated) >= g.Interval
+	if g.runner == nil || g.reconciling || !due {
+		g.mut.Unlock()
+		return nil
+	}
+	r := g.runner
+	g.reconciling = true
+	g.generated = time.Now()
+	g.mut.Unlock()
+
+	desired, err := g.generate(ctx)
+	if err != nil {
+		g.mut.Lock()
+		g.reconciling = false
+		g.mut.Unlock()
+		return err
+	}
+	go g.reconcile(r, desired)
+	return nil
+}
+
+// reconcile makes the children in r match desired
+func (g *Generator) reconcile(r *Runner, desired map[string]interface{}) {
+	defer func() {
+		g.mut.Lock()
+		g.reconciling = false
+		g.mut.Unlock()
+	}()
+	current := g.Children()
+
+	for id, h := range current {
+		if _, ok := desired[id]; ok {
+			continue
+		}
+		r.RemoveTask(h)
+		g.mut.Lock()
+		delete(g.children, id)
+		g.mut.Unlock()
+	}
+
+	ids := make([]string, 0, len(desired))
+	for id := range desired {
+		if _, ok := current[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		handles, err := r.addTasks([]registration{{task: desired[id], name: g.name + "/" + id}})
+		if err != nil {
+			if g.OnError != nil {
+				g.OnError(id, err)
+			}
+			continue
+		}
+		g.mut.Lock()
+		g.children[id] = handles[0]
+		g.mut.Unlock()
+	}
+}
+
+// Children returns the handles of the current children by ID
+func (g *Generator) Children() map[string]*TaskHandle {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	children := make(map[string]*TaskHandle, len(g.children))
+	for id, h := range g.children {
+		children[id] = h
+	}
+	return children
+}
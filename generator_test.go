@@ -0,0 +1,138 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor waits until cond is true
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitReconciled waits until the generator is done reconciling
+func waitReconciled(t *testing.T, g *Generator) {
+	t.Helper()
+	waitFor(t, "the reconciliation", func() bool {
+		g.mut.Lock()
+		defer g.mut.Unlock()
+		return !g.reconciling
+	})
+}
+
+type customerTask struct {
+	countTask
+	teardown int32
+}
+
+func (t *customerTask) Teardown() { atomic.AddInt32(&t.teardown, 1) }
+
+type failingTask struct{ err error }
+
+func (t failingTask) Run() error { return t.err }
+
+func TestGeneratorReconciles(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	var mut sync.Mutex
+	customers := map[string]*customerTask{"a": {}, "b": {}}
+	g := NewGenerator("customers", func(context.Context) (map[string]interface{}, error) {
+		mut.Lock()
+		defer mut.Unlock()
+		desired := map[string]interface{}{}
+		for id, task := range customers {
+			desired[id] = task
+		}
+		return desired, nil
+	})
+	r.AddTask(g)
+
+	r.tick(time.Now())
+	waitReconciled(t, g)
+	r.tick(time.Now())
+	waitReconciled(t, g)
+	if got := taskNames(r); got[0] != "customers" || got[1] != "customers/a" || got[2] != "customers/b" {
+		t.Fatalf("tasks = %v", got)
+	}
+	a := customers["a"]
+	if a.count() != 1 {
+		t.Errorf("child ran %d times, want 1", a.count())
+	}
+
+	mut.Lock()
+	delete(customers, "a")
+	customers["c"] = &customerTask{}
+	mut.Unlock()
+	r.tick(time.Now())
+	waitReconciled(t, g)
+	if got := taskNames(r); got[1] != "customers/b" || got[2] != "customers/c" {
+		t.Errorf("tasks = %v", got)
+	}
+	if atomic.LoadInt32(&a.teardown) != 1 {
+		t.Errorf("the stale child wasn't torn down")
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	events := recordEvents(r)
+	errGenerate := errors.New("customers unavailable")
+	errChild := errors.New("child failed")
+	fail := true
+	var addErrors int32
+	g := NewGenerator("gen", func(context.Context) (map[string]interface{}, error) {
+		if fail {
+			return nil, errGenerate
+		}
+		return map[string]interface{}{"ok": failingTask{errChild}, "bad": struct{}{}}, nil
+	})
+	g.OnError = func(id string, err error) {
+		if id == "bad" && errors.Is(err, ErrNotATask) {
+			atomic.AddInt32(&addErrors, 1)
+		}
+	}
+	r.AddTask(g)
+
+	r.tick(time.Now())
+	if failures := events.kind(EventFailure); len(failures) != 1 || !errors.Is(failures[0].Err, errGenerate) {
+		t.Fatalf("failures = %+v, want the generate error", failures)
+	}
+	fail = false
+	r.tick(time.Now())
+	waitReconciled(t, g)
+	if atomic.LoadInt32(&addErrors) != 1 {
+		t.Errorf("OnError wasn't called for the invalid child")
+	}
+	r.tick(time.Now())
+	failures := events.kind(EventFailure)
+	if last := failures[len(failures)-1]; last.Task.Name() != "gen/ok" || !errors.Is(last.Err, errChild) {
+		t.Errorf("last failure = %+v, want the error of the fallible child", last)
+	}
+}
+
+func TestGeneratorUsesRunnerContext(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	cancelled := make(chan struct{})
+	r.AddTask(NewGenerator("gen", func(ctx context.Context) (map[string]interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}))
+	r.tick(time.Now())
+	r.Stop()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Stop didn't cancel generate")
+	}
+}
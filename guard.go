@@ -0,0 +1,88 @@
+package llamatask
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Guard is a precondition evaluated before each execution of a task, when
+// ShouldRun returns false the execution is skipped for the given reason
+type Guard interface {
+	ShouldRun(ctx context.Context) (ok bool, reason string)
+}
+
+// GuardFunc is a function used as a Guard
+type GuardFunc func(ctx context.Context) (bool, string)
+
+// ShouldRun calls f
+func (f GuardFunc) ShouldRun(ctx context.Context) (bool, string) {
+	return f(ctx)
+}
+
+// GuardedTask is a Task that brings its own guards, they are evaluated
+// along with the ones attached to its handle
+type GuardedTask interface {
+	Task
+	Guards() []Guard
+}
+
+// AddGuard attaches guards to the task
+func (h *TaskHandle) AddGuard(guards ...Guard) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.guards = append(h.guards, guards...)
+}
+
+// shouldRun evaluates the guards of the task in order and returns the
+// reason of the first one that fails
+func (h *TaskHandle) shouldRun(ctx context.Context) (bool, string) {
+	h.mut.Lock()
+	guards := h.guards
+	h.mut.Unlock()
+	if guardedTask, ok := h.task.(guarder); ok {
+		guards = append(append([]Guard(nil), guardedTask.Guards()...), guards...)
+	}
+	for _, g := range guards {
+		if ok, reason := g.ShouldRun(ctx); !ok {
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+// FileExists is a Guard that only lets the task run if path exists
+func FileExists(path string) Guard {
+	return GuardFunc(func(context.Context) (bool, string) {
+		if _, err := os.Stat(path); err != nil {
+			return false, fmt.Sprintf("%s doesn't exist", path)
+		}
+		return true, ""
+	})
+}
+
+// Reachable is a Guard that only lets the task run if ping succeeds, like
+// (*sql.DB).PingContext
+func Reachable(name string, ping func(ctx context.Context) error) Guard {
+	return GuardFunc(func(ctx context.Context) (bool, string) {
+		if err := ping(ctx); err != nil {
+			return false, fmt.Sprintf("%s is unreachable: %v", name, err)
+		}
+		return true, ""
+	})
+}
+
+// NotEmpty is a Guard that only lets the task run if depth reports items
+// waiting, like the length of a queue
+func NotEmpty(name string, depth func(ctx context.Context) (int, error)) Guard {
+	return GuardFunc(func(ctx context.Context) (bool, string) {
+		n, err := depth(ctx)
+		if err != nil {
+			return false, fmt.Sprintf("checking %s: %v", name, err)
+		}
+		if n <= 0 {
+			return false, fmt.Sprintf("%s is empty", name)
+		}
+		return true, ""
+	})
+}
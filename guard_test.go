@@ -0,0 +1,95 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGuardSkips(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	events := recordEvents(r)
+	task := &countTask{}
+	h := r.AddTask(task)
+	allowed := false
+	h.AddGuard(
+		GuardFunc(func(context.Context) (bool, string) { return true, "" }),
+		GuardFunc(func(context.Context) (bool, string) { return allowed, "maintenance window" }),
+	)
+
+	r.tick(time.Now())
+	if task.count() != 0 {
+		t.Error("the guarded task ran")
+	}
+	if e := r.History()[0]; e.Outcome != OutcomeSkipped || e.Reason != "maintenance window" {
+		t.Errorf("got %s execution (%q), want the reason of the failing guard", e.Outcome, e.Reason)
+	}
+	if skips := events.kind(EventSkip); len(skips) != 1 || skips[0].Reason != "maintenance window" || skips[0].Task != h {
+		t.Errorf("got skip events %+v", skips)
+	}
+	if stats := h.Stats(); stats.Skipped != 1 {
+		t.Errorf("stats = %+v, want the skip counted", stats)
+	}
+
+	allowed = true
+	r.tick(time.Now())
+	if task.count() != 1 {
+		t.Error("the task didn't run once its guards passed")
+	}
+}
+
+func TestFileExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ready")
+	g := FileExists(path)
+	if ok, reason := g.ShouldRun(context.Background()); ok || reason != path+" doesn't exist" {
+		t.Errorf("got %v, %q for a missing file", ok, reason)
+	}
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := g.ShouldRun(context.Background()); !ok {
+		t.Error("the guard failed for an existing file")
+	}
+}
+
+func TestReachable(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	var pingErr error
+	g := Reachable("db", func(context.Context) error { return pingErr })
+	if ok, _ := g.ShouldRun(context.Background()); !ok {
+		t.Error("the guard failed although the ping succeeded")
+	}
+	pingErr = errRefused
+	if ok, reason := g.ShouldRun(context.Background()); ok || reason != "db is unreachable: connection refused" {
+		t.Errorf("got %v, %q for a failing ping", ok, reason)
+	}
+
+	// the ping gets the context of the execution
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g = Reachable("db", func(ctx context.Context) error { return ctx.Err() })
+	if ok, _ := g.ShouldRun(ctx); ok {
+		t.Error("the ping didn't get the context")
+	}
+}
+
+func TestNotEmpty(t *testing.T) {
+	for _, c := range []struct {
+		depth  int
+		err    error
+		ok     bool
+		reason string
+	}{
+		{3, nil, true, ""},
+		{0, nil, false, "jobs is empty"},
+		{0, errors.New("timeout"), false, "checking jobs: timeout"},
+	} {
+		g := NotEmpty("jobs", func(context.Context) (int, error) { return c.depth, c.err })
+		if ok, reason := g.ShouldRun(context.Background()); ok != c.ok || reason != c.reason {
+			t.Errorf("depth %d, %v: got %v, %q; want %v, %q", c.depth, c.err, ok, reason, c.ok, c.reason)
+		}
+	}
+}
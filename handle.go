@@ -0,0 +1,240 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TaskHandle is a reference to a task registered in a Runner
+type TaskHandle struct {
+	mut        sync.Mutex
+	runner     *Runner
+	task       interface{}
+	name       string
+	offset     time.Duration
+	labels     map[string]string
+	removed    chan struct{}
+	guards     []Guard
+	stats      Stats
+	deadLetter error
+	// waiting is set while an execution waits for a worker, see SetWorkers
+	waiting atomic.Bool
+}
+
+// Task returns the registered task
+func (h *TaskHandle) Task() interface{} {
+	return h.task
+}
+
+// Name returns the name of the task, it's unique in its Runner
+func (h *TaskHandle) Name() string {
+	return h.name
+}
+
+// Labels returns the labels of the task, like the metrics labels of a
+// template instance
+func (h *TaskHandle) Labels() map[string]string {
+	return h.labels
+}
+
+// Trigger runs the task right away in the current goroutine, its guards
+// are still evaluated. the execution is skipped if the Runner is drained,
+// a removed task doesn't run
+func (h *TaskHandle) Trigger() {
+	if h.isRemoved() {
+		return
+	}
+	r := h.runner
+	now := time.Now()
+	if !r.beginDispatch() {
+		r.skip(Execution{Task: h, Scheduled: now, Started: now}, "draining")
+		return
+	}
+	defer r.endDispatch()
+	r.execute(h, now)
+}
+
+// run runs the task once for the tick at scheduled
+func (h *TaskHandle) run(scheduled time.Time) error {
+	return runTask(h.runner.ctx, h.task, scheduled)
+}
+
+// runTask runs t once for the tick at scheduled, ctx is the context of the Runner
+func runTask(ctx context.Context, t interface{}, scheduled time.Time) error {
+	switch task := t.(type) {
+	case wrapper:
+		return task.runWrapped(ctx, scheduled)
+	case ScheduledTask:
+		task.RunScheduled(scheduled)
+	case ContextTask:
+		return task.RunContext(ctx)
+	case Task:
+		task.Run()
+	case FallibleTask:
+		return task.Run()
+	}
+	return nil
+}
+
+// runRecover runs the task once and returns the panic raised by it as an error
+func (h *TaskHandle) runRecover(scheduled time.Time) (err error, panicked bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			err, panicked = fmt.Errorf("llamatask: task panicked: %v", p), true
+		}
+	}()
+	return h.run(scheduled), false
+}
+
+// executeTick executes h for the tick at scheduled once the offset of h
+// has passed and a slot of workers (if not nil) is free, unless h is
+// removed or the Runner stopped meanwhile
+func (r *Runner) executeTick(h *TaskHandle, scheduled time.Time, workers chan struct{}) {
+	started := r.waitOffset(h, scheduled) && r.waitWorker(h, workers)
+	h.waiting.Store(false)
+	if !started {
+		return
+	}
+	if workers != nil {
+		defer func() { <-workers }()
+	}
+	r.execute(h, scheduled)
+}
+
+// waitWorker takes a slot of workers (if not nil) and reports whether it
+// got one before h was removed or the Runner stopped
+func (r *Runner) waitWorker(h *TaskHandle, workers chan struct{}) bool {
+	if workers == nil {
+		return true
+	}
+	select {
+	case workers <- struct{}{}:
+		return true
+	case <-h.removed:
+		return false
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// isRemoved reports whether h was removed from its Runner
+func (h *TaskHandle) isRemoved() bool {
+	select {
+	case <-h.removed:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitOffset waits until the offset of h after scheduled has passed, it
+// returns false if h is removed or the Runner stopped meanwhile
+func (r *Runner) waitOffset(h *TaskHandle, scheduled time.Time) bool {
+	if h.offset <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(time.Until(scheduled.Add(h.offset))):
+		return true
+	case <-h.removed:
+	case <-r.ctx.Done():
+	}
+	return false
+}
+
+// execute runs the task of h unless one of its guards prevents it, and
+// records the execution in the history
+func (r *Runner) execute(h *TaskHandle, scheduled time.Time) Execution {
+	return r.executeReplay(h, scheduled, 0)
+}
+
+func (r *Runner) executeReplay(h *TaskHandle, scheduled time.Time, replayOf uint64) Execution {
+	e := Execution{Task: h, Scheduled: scheduled, Started: time.Now(), ReplayOf: replayOf}
+	if err := h.DeadLetter(); err != nil && replayOf == 0 {
+		e.Outcome, e.Reason = OutcomeSkipped, "dead-lettered"
+		return e
+	}
+	if ok, reason := h.shouldRun(r.ctx); !ok {
+		return r.skip(e, reason)
+	}
+
+	q := r.quarantine.Load()
+	var marker string
+	if q != nil {
+		var ok bool
+		if marker, ok = q.begin(crashKey(h)); !ok {
+			return r.skip(e, "quarantined")
+		}
+	}
+
+	retries := int(atomic.LoadInt64(&r.retries))
+	var err error
+	panicked := false
+	for e.Attempts < retries+1 {
+		e.Attempts++
+		if q != nil {
+			err, panicked = h.runRecover(scheduled)
+		} else {
+			err = h.run(scheduled)
+		}
+		if err == nil || panicked || !isRetryable(err) {
+			break
+		}
+	}
+	e.Duration = time.Since(e.Started)
+	if q != nil && q.end(crashKey(h), marker, err, panicked || q.timeout > 0 && e.Duration > q.timeout) {
+		r.emit(Event{Kind: EventQuarantine, Time: time.Now(), Task: h, Err: err})
+	}
+
+	var skip *skipError
+	switch {
+	case err == nil:
+		e.Outcome = OutcomeCompleted
+	case errors.As(err, &skip):
+		e.Outcome, e.Reason = OutcomeSkipped, skip.reason
+	default:
+		e.Outcome, e.Err = OutcomeFailed, err
+	}
+	h.count(e.Outcome)
+	r.record(&e)
+
+	switch {
+	case e.Outcome == OutcomeSkipped:
+		r.emit(Event{Kind: EventSkip, Time: time.Now(), Task: h, Reason: e.Reason})
+	case IsPermanent(err):
+		h.mut.Lock()
+		h.deadLetter = err
+		h.mut.Unlock()
+		r.emit(Event{Kind: EventDeadLetter, Time: time.Now(), Task: h, Err: err})
+	case err != nil:
+		r.emit(Event{Kind: EventFailure, Time: time.Now(), Task: h, Err: err})
+	}
+	return e
+}
+
+// skip records e as an execution that didn't run for reason
+func (r *Runner) skip(e Execution, reason string) Execution {
+	e.Outcome, e.Reason = OutcomeSkipped, reason
+	e.Task.count(e.Outcome)
+	r.record(&e)
+	r.emit(Event{Kind: EventSkip, Time: e.Started, Task: e.Task, Reason: reason})
+	return e
+}
+
+// AddTaskResult is the result of AddTaskAsync
+type AddTaskResult struct {
+	Handle *TaskHandle
+	Err    error
+}
+
+// taskName returns the name of a NamedTask, or the type of t
+func taskName(t interface{}) string {
+	if namedTask, ok := t.(namer); ok {
+		return namedTask.Name()
+	}
+	return fmt.Sprintf("%T", t)
+}
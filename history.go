@@ -0,0 +1,143 @@
+package llamatask
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultHistorySize is the number of executions a Runner remembers
+const DefaultHistorySize = 100
+
+// ErrExecutionNotFound is returned by Replay when the execution isn't in
+// the history (anymore)
+var ErrExecutionNotFound = errors.New("llamatask: execution not found")
+
+// Outcome is how an execution ended
+type Outcome int
+
+const (
+	OutcomeCompleted Outcome = iota
+	OutcomeSkipped
+	OutcomeFailed
+)
+
+// String returns the name of the outcome
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeCompleted:
+		return "completed"
+	case OutcomeSkipped:
+		return "skipped"
+	case OutcomeFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// ScheduledTask is a Task that wants to know which tick it runs for, the
+// Runner calls RunScheduled instead of Run. replays pass the time of the
+// original tick
+type ScheduledTask interface {
+	Task
+	RunScheduled(scheduled time.Time)
+}
+
+// Execution is the record of one execution of a task
+type Execution struct {
+	ID   uint64
+	Task *TaskHandle
+	// Scheduled is the time of the tick the execution was for
+	Scheduled time.Time
+	Started   time.Time
+	Duration  time.Duration
+	Outcome   Outcome
+	// Reason explains why the execution was skipped
+	Reason string
+	// Err is the error of a failed execution
+	Err error
+	// Attempts is the number of times the task ran, retries included
+	Attempts int
+	// ReplayOf is the ID of the replayed execution, zero if it's not a replay
+	ReplayOf uint64
+}
+
+// SetHistorySize sets how many executions the Runner remembers, zero (or
+// less) disables the history
+func (r *Runner) SetHistorySize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	r.histMut.Lock()
+	defer r.histMut.Unlock()
+	r.historySize = n
+	r.trimHistory()
+}
+
+// History returns the remembered executions, oldest first
+func (r *Runner) History() []Execution {
+	r.histMut.Lock()
+	defer r.histMut.Unlock()
+	return append([]Execution(nil), r.history...)
+}
+
+// Execution returns the execution with the given ID from the history
+func (r *Runner) Execution(id uint64) (Execution, bool) {
+	r.histMut.Lock()
+	defer r.histMut.Unlock()
+	for _, e := range r.history {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return Execution{}, false
+}
+
+// Replay runs the task of a past execution again in the current goroutine,
+// for the same tick as the original. the replay is recorded in the history
+// as a new execution linked to the original one. a dead-lettered task is
+// replayed too, so a fix can be checked before calling Revive.
+// it returns ErrDraining if the Runner is drained, and ErrTaskNotFound if
+// the task was removed since
+func (r *Runner) Replay(id uint64) (Execution, error) {
+	original, ok := r.Execution(id)
+	if !ok {
+		return Execution{}, ErrExecutionNotFound
+	}
+	if original.Task.isRemoved() {
+		return Execution{}, ErrTaskNotFound
+	}
+	if !r.beginDispatch() {
+		return Execution{}, ErrDraining
+	}
+	defer r.endDispatch()
+	return r.executeReplay(original.Task, original.Scheduled, original.ID), nil
+}
+
+// record assigns an ID to e, appends it to the history and passes it to
+// the recorders
+func (r *Runner) record(e *Execution) {
+	r.histMut.Lock()
+	r.lastExecution++
+	e.ID = r.lastExecution
+	r.history = append(r.history, *e)
+	r.trimHistory()
+	recorders := r.recorders
+	r.histMut.Unlock()
+	for _, recorder := range recorders {
+		recorder(*e)
+	}
+}
+
+// onRecord registers f to be called with every recorded execution
+func (r *Runner) onRecord(f func(Execution)) {
+	r.histMut.Lock()
+	defer r.histMut.Unlock()
+	r.recorders = append(r.recorders[:len(r.recorders):len(r.recorders)], f)
+}
+
+// trimHistory drops the oldest executions, the caller must hold r.histMut
+func (r *Runner) trimHistory() {
+	if extra := len(r.history) - r.historySize; extra > 0 {
+		r.history = append(r.history[:0:0], r.history[extra:]...)
+	}
+}
@@ -0,0 +1,110 @@
+package llamatask
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// scheduledTask records the ticks it ran for
+type scheduledTask struct {
+	scheduled []time.Time
+}
+
+func (t *scheduledTask) Run() {}
+
+func (t *scheduledTask) RunScheduled(scheduled time.Time) {
+	t.scheduled = append(t.scheduled, scheduled)
+}
+
+func TestReplay(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &scheduledTask{}
+	r.AddTask(task)
+	tick := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.tick(tick)
+	original := r.History()[0]
+
+	replay, err := r.Replay(original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ReplayOf != original.ID || replay.ID == original.ID || replay.Outcome != OutcomeCompleted {
+		t.Errorf("replay = %+v, want a new execution linked to %d", replay, original.ID)
+	}
+	if len(task.scheduled) != 2 || !task.scheduled[1].Equal(tick) {
+		t.Errorf("the replay ran for %v, want the original tick", task.scheduled)
+	}
+	if _, err := r.Replay(12345); !errors.Is(err, ErrExecutionNotFound) {
+		t.Errorf("replaying a missing execution: got %v, want ErrExecutionNotFound", err)
+	}
+}
+
+func TestReplayDeadLettered(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &fallibleCountTask{err: Permanent(errors.New("bad input"))}
+	h := r.AddTask(task)
+	r.tick(time.Now())
+	if h.DeadLetter() == nil {
+		t.Fatal("the task wasn't dead-lettered")
+	}
+	failed := r.History()[0]
+
+	task.err = nil // the input got fixed
+	replay, err := r.Replay(failed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == 0 || replay.Outcome != OutcomeCompleted || task.count() != 2 {
+		t.Errorf("replay = %+v after %d runs, want a recorded completed run", replay, task.count())
+	}
+	if h.DeadLetter() == nil {
+		t.Errorf("the replay revived the task")
+	}
+}
+
+func TestReplayRemovedTask(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &customerTask{}
+	h := r.AddTask(task)
+	r.tick(time.Now())
+	if err := r.RemoveTask(h); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Replay(r.History()[0].ID); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("replaying a removed task: got %v, want ErrTaskNotFound", err)
+	}
+	h.Trigger()
+	if task.count() != 1 || len(r.History()) != 1 {
+		t.Errorf("the removed task ran %d times, want it to stay torn down", task.count())
+	}
+}
+
+func TestSetHistorySize(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.AddTask(&countTask{})
+	for i := 0; i < 5; i++ {
+		r.tick(time.Now())
+	}
+	r.SetHistorySize(2)
+	if got := len(r.History()); got != 2 {
+		t.Errorf("%d executions remembered, want 2", got)
+	}
+	r.SetHistorySize(-1)
+	r.tick(time.Now())
+	if got := len(r.History()); got != 0 {
+		t.Errorf("%d executions remembered, want 0", got)
+	}
+}
+
+// fallibleCountTask counts its runs and fails with err
+type fallibleCountTask struct {
+	countTask
+	err error
+}
+
+func (t *fallibleCountTask) Run() error {
+	t.countTask.Run()
+	return t.err
+}
@@ -0,0 +1,80 @@
+package llamatask
+
+// Status is a snapshot of the state of a Runner and its child runners
+type Status struct {
+	Running  bool
+	Paused   bool
+	Draining bool
+	Stopped  bool
+	Tasks    int
+	Children []Status
+}
+
+// Stop stops the Runner and its child runners, a stopped Runner can't be
+// started again
+// NOTE: it doesn't wait for the tasks that are currently running
+func (r *Runner) Stop() {
+	r.stop()
+	r.ticker.Stop()
+	for _, child := range r.Children() {
+		child.Stop()
+	}
+}
+
+// Pause stops running the tasks of the Runner and its child runners on
+// each tick until Resume is called
+// NOTE: it blocks until the current iteration of the loop is complete
+func (r *Runner) Pause() {
+	r.setPaused(true)
+}
+
+// Resume resumes a paused or drained Runner and its child runners
+func (r *Runner) Resume() {
+	r.setPaused(false)
+}
+
+func (r *Runner) setPaused(paused bool) {
+	r.mut.Lock()
+	r.paused = paused
+	if !paused {
+		r.draining.Store(false)
+	}
+	children := append([]*Runner(nil), r.children...)
+	r.mut.Unlock()
+	for _, child := range children {
+		child.setPaused(paused)
+	}
+}
+
+// Tasks returns the handles of the tasks registered in the Runner, child
+// runners are not included
+func (r *Runner) Tasks() []*TaskHandle {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]*TaskHandle(nil), r.tasks...)
+}
+
+// Children returns the runners registered as tasks in the Runner
+func (r *Runner) Children() []*Runner {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]*Runner(nil), r.children...)
+}
+
+// Status returns the current state of the Runner and its child runners
+func (r *Runner) Status() Status {
+	r.mut.Lock()
+	status := Status{
+		Running:  r.running,
+		Paused:   r.paused,
+		Draining: r.draining.Load(),
+		Stopped:  r.ctx.Err() != nil,
+		Tasks:    len(r.tasks),
+	}
+	children := append([]*Runner(nil), r.children...)
+	r.mut.Unlock()
+	for _, child := range children {
+		status.Children = append(status.Children, child.Status())
+	}
+	return status
+}
@@ -0,0 +1,69 @@
+package llamatask
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNestedRunnerCascade(t *testing.T) {
+	parent, _ := newTestRunner(time.Minute, false)
+	child, _ := newTestRunner(time.Minute, false)
+	task := &countTask{}
+	child.AddTask(task)
+	parent.AddTask(child)
+
+	parent.Pause()
+	if status := parent.Status(); !status.Paused || len(status.Children) != 1 || !status.Children[0].Paused {
+		t.Fatalf("status after Pause = %+v, want the child paused", status)
+	}
+	child.tick(time.Now())
+	if task.count() != 0 {
+		t.Errorf("the task of a paused child ran")
+	}
+	parent.Resume()
+	parent.Stop()
+	if !child.Status().Stopped {
+		t.Errorf("the child wasn't stopped with its parent")
+	}
+}
+
+func TestNestedRunnerRejectsCycles(t *testing.T) {
+	a, _ := newTestRunner(time.Minute, false)
+	b, _ := newTestRunner(time.Minute, false)
+	c, _ := newTestRunner(time.Minute, false)
+
+	if _, err := a.AddTasks(a); !errors.Is(err, ErrInvalidNesting) {
+		t.Errorf("adding a runner to itself: got %v, want ErrInvalidNesting", err)
+	}
+	if _, err := a.AddTasks(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddTasks(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddTasks(a); !errors.Is(err, ErrInvalidNesting) {
+		t.Errorf("adding an ancestor: got %v, want ErrInvalidNesting", err)
+	}
+	d, _ := newTestRunner(time.Minute, false)
+	if _, err := d.AddTasks(c); !errors.Is(err, ErrInvalidNesting) {
+		t.Errorf("adding a runner to a second parent: got %v, want ErrInvalidNesting", err)
+	}
+	e, _ := newTestRunner(time.Minute, false)
+	if _, err := d.AddTasks(e, e); !errors.Is(err, ErrInvalidNesting) {
+		t.Errorf("adding a runner twice: got %v, want ErrInvalidNesting", err)
+	}
+	if len(d.Children()) != 0 || len(c.Children()) != 0 {
+		t.Errorf("rejected runners were added")
+	}
+	if res := <-c.AddTaskAsync(a); !errors.Is(res.Err, ErrInvalidNesting) {
+		t.Errorf("AddTaskAsync of an ancestor: got %v, want ErrInvalidNesting", res.Err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("AddTask of the runner itself didn't panic")
+		}
+	}()
+	a.AddTask(a)
+}
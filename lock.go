@@ -0,0 +1,85 @@
+package llamatask
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Locker grants leases on keys, so a job runs in a single process at a
+// time. a lease expires after its TTL, so the key held by a process that
+// crashed is freed without Unlock
+type Locker interface {
+	// Lock acquires key for owner until ttl has passed, it reports false if
+	// another owner holds it. the owner holding key extends its lease
+	Lock(key, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases key if owner holds it
+	Unlock(key, owner string) error
+}
+
+// StoreLocker is a Locker keeping its leases in a JobStore, so the
+// processes sharing the store share the locks
+type StoreLocker struct {
+	store JobStore
+}
+
+// NewStoreLocker creates a StoreLocker keeping its leases in s
+func NewStoreLocker(s JobStore) *StoreLocker {
+	return &StoreLocker{store: s}
+}
+
+// lease is the holder of a key of a StoreLocker
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// Lock acquires key for owner until ttl has passed
+func (l *StoreLocker) Lock(key, owner string, ttl time.Duration) (bool, error) {
+	for {
+		current, held, err := l.current(key)
+		if err != nil {
+			return false, err
+		}
+		now := time.Now()
+		if held.Owner != owner && now.Before(held.Expires) {
+			return false, nil
+		}
+		value, err := json.Marshal(lease{Owner: owner, Expires: now.Add(ttl)})
+		if err != nil {
+			return false, err
+		}
+		// try again if another owner took the key meanwhile
+		if ok, err := l.store.CompareAndSet("lock/"+key, current, value); ok || err != nil {
+			return ok, err
+		}
+	}
+}
+
+// Unlock releases key if owner holds it
+func (l *StoreLocker) Unlock(key, owner string) error {
+	for {
+		current, held, err := l.current(key)
+		if err != nil || held.Owner != owner || !time.Now().Before(held.Expires) {
+			return err
+		}
+		// an expired lease is free, the JobStore can't delete a key only
+		// if it's unchanged
+		value, err := json.Marshal(lease{})
+		if err != nil {
+			return err
+		}
+		if ok, err := l.store.CompareAndSet("lock/"+key, current, value); ok || err != nil {
+			return err
+		}
+	}
+}
+
+// current returns the stored lease of key and its value, nil if it's not set
+func (l *StoreLocker) current(key string) ([]byte, lease, error) {
+	var held lease
+	value, ok, err := l.store.Get("lock/" + key)
+	if err != nil || !ok {
+		return nil, held, err
+	}
+	return value, held, json.Unmarshal(value, &held)
+}
@@ -0,0 +1,34 @@
+package llamatask_test
+
+import (
+	"testing"
+
+	"github.com/LlamaNite/llamatask"
+	"github.com/LlamaNite/llamatask/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storetest.TestJobStore(t, func(t *testing.T) llamatask.JobStore {
+		return llamatask.NewMemoryStore()
+	})
+}
+
+func TestMemoryStorePersistence(t *testing.T) {
+	// the data of a MemoryStore lives as long as the store itself
+	s := llamatask.NewMemoryStore()
+	storetest.TestJobStorePersistence(t, func(t *testing.T) llamatask.JobStore {
+		return s
+	})
+}
+
+func TestStoreLocker(t *testing.T) {
+	storetest.TestLocker(t, func(t *testing.T) llamatask.Locker {
+		return llamatask.NewStoreLocker(llamatask.NewMemoryStore())
+	})
+}
+
+func TestQueue(t *testing.T) {
+	storetest.TestQueue(t, func(t *testing.T, workers int) storetest.Queue {
+		return llamatask.NewQueue(workers)
+	})
+}
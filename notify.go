@@ -0,0 +1,358 @@
+package llamatask
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity is how important a Notification is
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// MarshalJSON encodes the severity as its name
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Notification is a message about a task sent through a Notifier
+type Notification struct {
+	Task     string    `json:"task"`
+	Severity Severity  `json:"severity"`
+	Tags     []string  `json:"tags,omitempty"`
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// TaggedTask is a Task with tags, they are used to route its notifications
+type TaggedTask interface {
+	Task
+	Tags() []string
+}
+
+// WebhookNotifier POSTs notifications as JSON to URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+// Notify sends n to the webhook
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, w.Client, w.URL, n)
+}
+
+// SlackNotifier sends notifications to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client // defaults to http.DefaultClient
+}
+
+// Notify sends n to the incoming webhook
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	text := fmt.Sprintf("*[%s]* %s: %s", strings.ToUpper(n.Severity.String()), n.Task, n.Message)
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": text})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("llamatask: webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// EmailNotifier sends notifications by email through the SMTP server at Addr
+type EmailNotifier struct {
+	Addr string // host:port
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+// Notify sends n as an email, the SMTP exchange is aborted when ctx is done
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [%s] %s\r\n", n.Severity, n.Task)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nTime: %s\r\n", n.Message, n.Time.Format(time.RFC3339))
+	if len(n.Tags) > 0 {
+		fmt.Fprintf(&msg, "Tags: %s\r\n", strings.Join(n.Tags, ", "))
+	}
+	if err := e.send(ctx, msg.Bytes()); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// send is smtp.SendMail on a connection bound to ctx
+func (e *EmailNotifier) send(ctx context.Context, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// closing the connection unblocks the client when ctx is cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if e.Auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("llamatask: smtp server doesn't support AUTH")
+		}
+		if err := c.Auth(e.Auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Rule routes the notifications matching it to Notifier
+type Rule struct {
+	// Tags matches notifications with any of them, empty matches all
+	Tags        []string
+	MinSeverity Severity
+	Notifier    Notifier
+}
+
+func (rule Rule) matches(n Notification) bool {
+	if n.Severity < rule.MinSeverity {
+		return false
+	}
+	if len(rule.Tags) == 0 {
+		return true
+	}
+	for _, tag := range rule.Tags {
+		for _, t := range n.Tags {
+			if tag == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Router sends notifications to the notifiers of the matching rules. the
+// same notification (same task and message) is sent again through a rule
+// only once Renotify has passed, a failed send isn't remembered. while it's
+// being sent the same notification isn't sent again through the rule
+type Router struct {
+	Rules    []Rule
+	Renotify time.Duration
+	// Timeout bounds the notifications sent from HandleEvent, zero means none
+	Timeout time.Duration
+	// OnError is called when HandleEvent fails to send a notification
+	OnError func(error)
+
+	mut     sync.Mutex
+	sent    map[string]time.Time
+	sending map[string]bool
+	pruned  time.Time
+}
+
+// NewRouter creates a Router with the given rules
+func NewRouter(renotify time.Duration, rules ...Rule) *Router {
+	return &Router{Rules: rules, Renotify: renotify, Timeout: 30 * time.Second}
+}
+
+// Notify sends n through every matching rule, it returns the first error
+func (r *Router) Notify(ctx context.Context, n Notification) error {
+	var firstErr error
+	for i, rule := range r.Rules {
+		key := fmt.Sprintf("%d\x00%s\x00%s", i, n.Task, n.Message)
+		if !rule.matches(n) || !r.reserve(key, n.Time) {
+			continue
+		}
+		err := rule.Notifier.Notify(ctx, n)
+		r.release(key, n.Time, err == nil)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// reserve reports whether key can be sent at now, neither being sent nor
+// sent less than Renotify ago, and marks it as being sent. the keys sent
+// before that are forgotten
+func (r *Router) reserve(key string, now time.Time) bool {
+	if r.Renotify <= 0 {
+		return true
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if now.Sub(r.pruned) >= r.Renotify {
+		for k, last := range r.sent {
+			if now.Sub(last) >= r.Renotify {
+				delete(r.sent, k)
+			}
+		}
+		r.pruned = now
+	}
+	if last, ok := r.sent[key]; r.sending[key] || ok && now.Sub(last) < r.Renotify {
+		return false
+	}
+	if r.sending == nil {
+		r.sending = map[string]bool{}
+	}
+	r.sending[key] = true
+	return true
+}
+
+// release ends the send of key reserved at now, it's remembered as sent
+// if it succeeded
+func (r *Router) release(key string, now time.Time, sent bool) {
+	if r.Renotify <= 0 {
+		return
+	}
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	delete(r.sending, key)
+	if !sent {
+		return
+	}
+	if r.sent == nil {
+		r.sent = map[string]time.Time{}
+	}
+	r.sent[key] = now
+}
+
+// HandleEvent notifies failures and dead-lettered tasks, it's meant to be
+// registered with Runner.OnEvent. notifications are sent in a goroutine
+func (r *Router) HandleEvent(e Event) {
+	n := Notification{Time: e.Time}
+	switch e.Kind {
+	case EventFailure:
+		n.Severity = SeverityError
+		n.Message = fmt.Sprintf("execution failed: %v", e.Err)
+	case EventDeadLetter:
+		n.Severity = SeverityCritical
+		n.Message = fmt.Sprintf("task dead-lettered: %v", e.Err)
+	default:
+		return
+	}
+	n.Task = e.Task.Name()
+	if tagged, ok := e.Task.Task().(interface{ Tags() []string }); ok {
+		n.Tags = append(n.Tags, tagged.Tags()...)
+	}
+	// labels can be matched by rules as key=value tags
+	for _, key := range sortedKeys(e.Task.Labels()) {
+		n.Tags = append(n.Tags, key+"="+e.Task.Labels()[key])
+	}
+
+	go func() {
+		ctx := context.Background()
+		if r.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+		}
+		if err := r.Notify(ctx, n); err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+	}()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,349 @@
+package llamatask
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ct := req.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("content type %q", ct)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer server.Close()
+
+	n := Notification{Task: "export", Severity: SeverityError, Tags: []string{"billing"}, Message: "boom", Time: time.Now()}
+	if err := (&WebhookNotifier{URL: server.URL}).Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	body := <-received
+	if body["task"] != "export" || body["severity"] != "error" || body["message"] != "boom" {
+		t.Errorf("unexpected payload %v", body)
+	}
+}
+
+func TestWebhookNotifierStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := (&WebhookNotifier{URL: server.URL}).Notify(context.Background(), Notification{Task: "export"})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("got %v, want the status in the error", err)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	received := make(chan map[string]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		received <- body
+	}))
+	defer server.Close()
+
+	n := Notification{Task: "export", Severity: SeverityCritical, Message: "dead-lettered"}
+	if err := (&SlackNotifier{WebhookURL: server.URL}).Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if text := (<-received)["text"]; text != "*[CRITICAL]* export: dead-lettered" {
+		t.Errorf("got text %q", text)
+	}
+}
+
+// smtpServer is a local SMTP stand-in that accepts every message
+type smtpServer struct {
+	listener net.Listener
+	// greet is false for a server that never answers
+	greet bool
+
+	mut      sync.Mutex
+	from     string
+	to       []string
+	messages []string
+}
+
+func newSMTPServer(t *testing.T, greet bool) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, greet: greet}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	if !s.greet {
+		// hold the connection until the client gives up
+		conn.Read(make([]byte, 1))
+		return
+	}
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mut.Lock()
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			s.from = strings.Fields(line[len("MAIL FROM:"):])[0]
+			reply("250 OK")
+		case "RCPT":
+			s.to = append(s.to, line[len("RCPT TO:"):])
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil || line == ".\r\n" {
+					break
+				}
+				msg.WriteString(line)
+			}
+			s.messages = append(s.messages, msg.String())
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			s.mut.Unlock()
+			return
+		default:
+			reply("502 not implemented")
+		}
+		s.mut.Unlock()
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	server := newSMTPServer(t, true)
+	e := &EmailNotifier{
+		Addr: server.listener.Addr().String(),
+		From: "llamatask@example.com",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	}
+	n := Notification{Task: "export", Severity: SeverityError, Tags: []string{"billing"}, Message: "boom", Time: time.Now()}
+	if err := e.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mut.Lock()
+	defer server.mut.Unlock()
+	if server.from != "<llamatask@example.com>" || len(server.to) != 2 {
+		t.Errorf("envelope from %s to %v", server.from, server.to)
+	}
+	if len(server.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(server.messages))
+	}
+	msg := server.messages[0]
+	for _, want := range []string{"Subject: [error] export", "boom", "Tags: billing"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestEmailNotifierContext(t *testing.T) {
+	server := newSMTPServer(t, false)
+	e := &EmailNotifier{Addr: server.listener.Addr().String(), From: "a@example.com", To: []string{"b@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := e.Notify(ctx, Notification{Task: "export"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Notify returned after %s", elapsed)
+	}
+}
+
+// recordingNotifier records the notifications, it fails while err is set
+type recordingNotifier struct {
+	mut  sync.Mutex
+	sent []Notification
+	err  error
+}
+
+func (rn *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	rn.mut.Lock()
+	defer rn.mut.Unlock()
+	if rn.err != nil {
+		return rn.err
+	}
+	rn.sent = append(rn.sent, n)
+	return nil
+}
+
+func (rn *recordingNotifier) count() int {
+	rn.mut.Lock()
+	defer rn.mut.Unlock()
+	return len(rn.sent)
+}
+
+func TestRouterRules(t *testing.T) {
+	billing, critical, all := &recordingNotifier{}, &recordingNotifier{}, &recordingNotifier{}
+	router := NewRouter(0,
+		Rule{Tags: []string{"billing"}, Notifier: billing},
+		Rule{MinSeverity: SeverityCritical, Notifier: critical},
+		Rule{Notifier: all},
+	)
+	now := time.Now()
+	router.Notify(context.Background(), Notification{Task: "a", Severity: SeverityError, Tags: []string{"billing"}, Time: now})
+	router.Notify(context.Background(), Notification{Task: "b", Severity: SeverityCritical, Time: now})
+	router.Notify(context.Background(), Notification{Task: "c", Severity: SeverityInfo, Tags: []string{"search"}, Time: now})
+
+	if billing.count() != 1 || critical.count() != 1 || all.count() != 3 {
+		t.Errorf("billing got %d, critical %d, all %d; want 1, 1, 3", billing.count(), critical.count(), all.count())
+	}
+}
+
+func TestRouterRenotify(t *testing.T) {
+	notifier := &recordingNotifier{}
+	router := NewRouter(time.Hour, Rule{Notifier: notifier})
+	n := Notification{Task: "export", Message: "boom", Time: time.Now()}
+
+	router.Notify(context.Background(), n)
+	router.Notify(context.Background(), n)
+	if notifier.count() != 1 {
+		t.Fatalf("the duplicate was sent, got %d notifications", notifier.count())
+	}
+	other := n
+	other.Message = "other"
+	router.Notify(context.Background(), other)
+	n.Time = n.Time.Add(time.Hour)
+	router.Notify(context.Background(), n)
+	if notifier.count() != 3 {
+		t.Errorf("got %d notifications, want 3", notifier.count())
+	}
+}
+
+func TestRouterRetriesFailedSend(t *testing.T) {
+	notifier := &recordingNotifier{err: errors.New("unreachable")}
+	router := NewRouter(time.Hour, Rule{Notifier: notifier})
+	n := Notification{Task: "export", Message: "boom", Time: time.Now()}
+
+	if err := router.Notify(context.Background(), n); err == nil {
+		t.Fatal("the failed send wasn't reported")
+	}
+	notifier.mut.Lock()
+	notifier.err = nil
+	notifier.mut.Unlock()
+	if err := router.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	if notifier.count() != 1 {
+		t.Errorf("the notification wasn't sent again after the failure")
+	}
+}
+
+// slowNotifier blocks each send until release is closed
+type slowNotifier struct {
+	recordingNotifier
+	started chan struct{}
+	release chan struct{}
+}
+
+func (sn *slowNotifier) Notify(ctx context.Context, n Notification) error {
+	sn.started <- struct{}{}
+	<-sn.release
+	return sn.recordingNotifier.Notify(ctx, n)
+}
+
+func TestRouterConcurrentDuplicates(t *testing.T) {
+	notifier := &slowNotifier{started: make(chan struct{}, 2), release: make(chan struct{})}
+	router := NewRouter(time.Hour, Rule{Notifier: notifier})
+	n := Notification{Task: "export", Message: "boom", Time: time.Now()}
+
+	done := make(chan struct{})
+	go func() {
+		router.Notify(context.Background(), n)
+		close(done)
+	}()
+	<-notifier.started
+	// the first send is still in flight
+	if err := router.Notify(context.Background(), n); err != nil {
+		t.Fatal(err)
+	}
+	close(notifier.release)
+	<-done
+	if notifier.count() != 1 {
+		t.Errorf("got %d notifications while the first one was in flight, want 1", notifier.count())
+	}
+}
+
+func TestRouterForgetsOldSends(t *testing.T) {
+	router := NewRouter(time.Hour, Rule{Notifier: &recordingNotifier{}})
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		router.Notify(context.Background(), Notification{Task: "export", Message: fmt.Sprint(i), Time: now})
+	}
+	router.Notify(context.Background(), Notification{Task: "export", Message: "later", Time: now.Add(2 * time.Hour)})
+	router.mut.Lock()
+	defer router.mut.Unlock()
+	if len(router.sent) != 1 {
+		t.Errorf("%d sends remembered, want only the one within Renotify", len(router.sent))
+	}
+}
+
+type taggedTask struct{ countTask }
+
+func (t *taggedTask) Tags() []string { return []string{"billing"} }
+
+func TestRouterHandleEvent(t *testing.T) {
+	notifier := &recordingNotifier{}
+	router := NewRouter(0, Rule{Tags: []string{"team=payments"}, Notifier: notifier})
+	h := &TaskHandle{name: "export", task: &taggedTask{}, labels: map[string]string{"team": "payments"}}
+
+	router.HandleEvent(Event{Kind: EventSkip, Time: time.Now(), Task: h, Reason: "paused"})
+	router.HandleEvent(Event{Kind: EventFailure, Time: time.Now(), Task: h, Err: errors.New("boom")})
+	waitFor(t, "the notification", func() bool { return notifier.count() == 1 })
+
+	notifier.mut.Lock()
+	defer notifier.mut.Unlock()
+	n := notifier.sent[0]
+	if n.Task != "export" || n.Severity != SeverityError || strings.Join(n.Tags, ",") != "billing,team=payments" {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
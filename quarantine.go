@@ -0,0 +1,314 @@
+package llamatask
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQuarantined is reported by a Queue for the jobs it doesn't run because
+// they're quarantined
+var ErrQuarantined = errors.New("llamatask: job is quarantined")
+
+// quarantinePolicy keeps the crash count of each task in a JobStore. each
+// execution leaves a marker in the store until it ends, so the markers
+// found from a previous process are the executions that took it down and
+// are counted as crashes. the executions still running aren't
+type quarantinePolicy struct {
+	store      JobStore
+	maxCrashes int
+	timeout    time.Duration
+
+	// process prefixes the markers of this process
+	process    string
+	executions int64
+	mut        sync.Mutex
+	recovered  map[string]bool
+}
+
+func newQuarantinePolicy(store JobStore, maxCrashes int, timeout time.Duration) *quarantinePolicy {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &quarantinePolicy{
+		store:      store,
+		maxCrashes: maxCrashes,
+		timeout:    timeout,
+		process:    hex.EncodeToString(id),
+		recovered:  map[string]bool{},
+	}
+}
+
+// SetQuarantine quarantines tasks after maxCrashes consecutive crashes: a
+// panic, an execution longer than timeout (zero disables it) or a process
+// that died during an execution. the crash counts are kept in the JobStore
+// of the Runner, so SetJobStore has to be called before. the executions in
+// progress of another process sharing the store would be taken for the
+// ones of a process that died. while quarantine is enabled panics are
+// recovered and reported as failures.
+// zero maxCrashes disables quarantine
+func (r *Runner) SetQuarantine(maxCrashes int, timeout time.Duration) {
+	if maxCrashes <= 0 {
+		r.quarantine.Store(nil)
+		return
+	}
+	r.mut.Lock()
+	store := r.store
+	r.mut.Unlock()
+	r.quarantine.Store(newQuarantinePolicy(store, maxCrashes, timeout))
+}
+
+// Quarantined returns the tasks that are quarantined
+func (r *Runner) Quarantined() []*TaskHandle {
+	q := r.quarantine.Load()
+	if q == nil {
+		return nil
+	}
+	var quarantined []*TaskHandle
+	for _, h := range r.Tasks() {
+		if q.crashes(crashKey(h)) >= q.maxCrashes {
+			quarantined = append(quarantined, h)
+		}
+	}
+	return quarantined
+}
+
+// Release clears the crash count of a task, taking it out of quarantine
+func (r *Runner) Release(h *TaskHandle) error {
+	q := r.quarantine.Load()
+	if q == nil {
+		return nil
+	}
+	return q.store.Delete(crashKey(h))
+}
+
+func crashKey(h *TaskHandle) string {
+	return "crash/" + h.Name()
+}
+
+// crashes returns the crash count kept at key
+func (q *quarantinePolicy) crashes(key string) int {
+	q.recoverMarkers(key)
+	value, _, err := q.store.Get(key)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(value))
+	return n
+}
+
+// add adds delta to the crash count kept at key and returns the new count
+func (q *quarantinePolicy) add(key string, delta int) (int, error) {
+	for {
+		old, ok, err := q.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := strconv.Atoi(string(old))
+		if !ok {
+			old = nil
+		}
+		n += delta
+		if n < 0 {
+			n = 0
+		}
+		if swapped, err := q.store.CompareAndSet(key, old, []byte(strconv.Itoa(n))); err != nil || swapped {
+			return n, err
+		}
+	}
+}
+
+// begin records the start of an execution and returns its marker, it
+// returns false if the task is quarantined
+func (q *quarantinePolicy) begin(key string) (string, bool) {
+	if q.crashes(key) >= q.maxCrashes {
+		return "", false
+	}
+	marker := q.process + "-" + strconv.FormatInt(atomic.AddInt64(&q.executions, 1), 10)
+	q.updateRunning(key, func(markers []string) []string {
+		return append(markers, marker)
+	})
+	return marker, true
+}
+
+// end records the end of the execution of marker, it reports whether the
+// task just got quarantined
+func (q *quarantinePolicy) end(key, marker string, err error, crashed bool) bool {
+	q.updateRunning(key, func(markers []string) []string {
+		return removeString(markers, marker)
+	})
+	switch {
+	case crashed:
+		n, _ := q.add(key, 1)
+		return n == q.maxCrashes
+	case err == nil:
+		q.store.Delete(key)
+	}
+	// failures aren't crashes, but don't reset the consecutive count
+	return false
+}
+
+// recoverMarkers counts the markers of key left by a previous process as
+// crashes, once per key
+func (q *quarantinePolicy) recoverMarkers(key string) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if q.recovered[key] {
+		return
+	}
+	orphans := 0
+	err := q.updateRunning(key, func(markers []string) []string {
+		orphans = 0
+		var kept []string
+		for _, m := range markers {
+			if strings.HasPrefix(m, q.process+"-") {
+				kept = append(kept, m)
+			} else {
+				orphans++
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		return
+	}
+	if orphans > 0 {
+		if _, err := q.add(key, orphans); err != nil {
+			return
+		}
+	}
+	q.recovered[key] = true
+}
+
+// updateRunning replaces the markers of the executions of key in progress
+// with the result of f
+func (q *quarantinePolicy) updateRunning(key string, f func(markers []string) []string) error {
+	key += "/running"
+	for {
+		old, ok, err := q.store.Get(key)
+		if err != nil {
+			return err
+		}
+		var markers []string
+		if ok {
+			if err := json.Unmarshal(old, &markers); err != nil {
+				return err
+			}
+		} else {
+			old = nil
+		}
+		value, err := json.Marshal(f(markers))
+		if err != nil {
+			return err
+		}
+		if swapped, err := q.store.CompareAndSet(key, old, value); err != nil || swapped {
+			return err
+		}
+	}
+}
+
+func removeString(s []string, x string) []string {
+	for i, v := range s {
+		if v == x {
+			return append(s[:i:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+// SetQuarantine quarantines jobs after maxCrashes consecutive crashes, like
+// Runner.SetQuarantine. jobs are told apart by their name if they're a
+// NamedTask, or by their type, and their crash counts are kept in store.
+// a quarantined job is dropped and reported to OnError with ErrQuarantined.
+// zero maxCrashes disables quarantine
+func (q *Queue) SetQuarantine(store JobStore, maxCrashes int, timeout time.Duration) {
+	if maxCrashes <= 0 {
+		q.quarantine.Store(nil)
+		return
+	}
+	q.quarantine.Store(newQuarantinePolicy(store, maxCrashes, timeout))
+}
+
+// Quarantined returns the names of the quarantined jobs. the crash counts
+// survive a restart, but a job shows up here only once it's enqueued again
+func (q *Queue) Quarantined() []string {
+	policy := q.quarantine.Load()
+	if policy == nil {
+		return nil
+	}
+	q.mut.Lock()
+	names := make([]string, 0, len(q.crashed))
+	for name := range q.crashed {
+		names = append(names, name)
+	}
+	q.mut.Unlock()
+
+	var quarantined []string
+	for _, name := range names {
+		if policy.crashes(queueCrashKey(name)) >= policy.maxCrashes {
+			quarantined = append(quarantined, name)
+		}
+	}
+	sort.Strings(quarantined)
+	return quarantined
+}
+
+// Release clears the crash count of a job, taking it out of quarantine
+func (q *Queue) Release(name string) error {
+	policy := q.quarantine.Load()
+	if policy == nil {
+		return nil
+	}
+	q.mut.Lock()
+	delete(q.crashed, name)
+	q.mut.Unlock()
+	return policy.store.Delete(queueCrashKey(name))
+}
+
+func queueCrashKey(name string) string {
+	return "crash/queue/" + name
+}
+
+// runQuarantined runs a job unless it's quarantined, its panics are
+// recovered and counted as crashes
+func (q *Queue) runQuarantined(policy *quarantinePolicy, job interface{}) error {
+	name := taskName(job)
+	key := queueCrashKey(name)
+	marker, ok := policy.begin(key)
+	if !ok {
+		q.noteCrashed(name)
+		return fmt.Errorf("%w: %s", ErrQuarantined, name)
+	}
+	start := time.Now()
+	err, panicked := recoverJob(job)
+	crashed := panicked || policy.timeout > 0 && time.Since(start) > policy.timeout
+	policy.end(key, marker, err, crashed)
+	if crashed {
+		q.noteCrashed(name)
+	}
+	return err
+}
+
+// noteCrashed remembers that the job crashed, for Quarantined
+func (q *Queue) noteCrashed(name string) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.crashed[name] = true
+}
+
+// recoverJob runs a job and returns the panic raised by it as an error
+func recoverJob(job interface{}) (err error, panicked bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			err, panicked = fmt.Errorf("llamatask: job panicked: %v", p), true
+		}
+	}()
+	return runJob(job), false
+}
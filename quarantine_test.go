@@ -0,0 +1,199 @@
+package llamatask
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// poisonTask panics while poisoned is set
+type poisonTask struct {
+	name     string
+	mut      sync.Mutex
+	poisoned bool
+	runs     int
+}
+
+func (t *poisonTask) Name() string { return t.name }
+
+func (t *poisonTask) Run() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.runs++
+	if t.poisoned {
+		panic("corrupted payload")
+	}
+}
+
+func (t *poisonTask) count() int {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.runs
+}
+
+func (t *poisonTask) cure() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.poisoned = false
+}
+
+func TestQuarantineRecordsSkips(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetQuarantine(2, 0)
+	events := recordEvents(r)
+	task := &poisonTask{name: "import", poisoned: true}
+	h := r.AddTask(task)
+
+	for i := 0; i < 4; i++ {
+		r.tick(time.Now())
+	}
+	if task.count() != 2 {
+		t.Errorf("the task ran %d times, want 2 before its quarantine", task.count())
+	}
+	if n := len(events.kind(EventQuarantine)); n != 1 {
+		t.Errorf("got %d quarantine events, want 1", n)
+	}
+	if skips := events.kind(EventSkip); len(skips) != 2 || skips[0].Reason != "quarantined" {
+		t.Errorf("got skip events %+v, want 2 quarantined skips", skips)
+	}
+	if stats := h.Stats(); stats.Executions != 4 || stats.Failed != 2 || stats.Skipped != 2 {
+		t.Errorf("stats = %+v, want 4 executions, 2 failed, 2 skipped", stats)
+	}
+	if history := r.History(); len(history) != 4 || history[3].Reason != "quarantined" {
+		t.Errorf("the quarantined skips aren't in the history")
+	}
+	if q := r.Quarantined(); len(q) != 1 || q[0] != h {
+		t.Fatalf("Quarantined = %v", q)
+	}
+
+	task.cure()
+	if err := r.Release(h); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if task.count() != 3 || len(r.Quarantined()) != 0 {
+		t.Errorf("the released task didn't run")
+	}
+}
+
+func TestQuarantineSurvivesRestart(t *testing.T) {
+	store := NewMemoryStore()
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetJobStore(store)
+	r.SetQuarantine(1, 0)
+	h := r.AddTask(&poisonTask{name: "import"})
+	// the process dies during the execution
+	r.quarantine.Load().begin(crashKey(h))
+
+	restarted, _ := newTestRunner(time.Minute, false)
+	restarted.SetJobStore(store)
+	restarted.SetQuarantine(1, 0)
+	task := &poisonTask{name: "import"}
+	restarted.AddTask(task)
+	restarted.tick(time.Now())
+	if task.count() != 0 || len(restarted.Quarantined()) != 1 {
+		t.Errorf("the task that crashed the previous process wasn't quarantined")
+	}
+}
+
+func TestQuarantineIgnoresRunningExecutions(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	r.SetQuarantine(2, 0)
+	task := newBlockingTask()
+	h := r.AddTask(task)
+
+	// the executions overlap, none of them crashed
+	for i := 0; i < 3; i++ {
+		r.tick(time.Now())
+	}
+	<-task.started
+	close(task.release)
+	r.inFlight.Wait()
+	if stats := h.Stats(); stats.Completed != 3 || stats.Skipped != 0 {
+		t.Errorf("stats = %+v, want every execution to run", stats)
+	}
+	if len(r.Quarantined()) != 0 {
+		t.Error("the task was quarantined for running slowly")
+	}
+}
+
+func TestQueueQuarantineParallelJobs(t *testing.T) {
+	q := NewQueue(4)
+	defer q.Close()
+	q.SetQuarantine(NewMemoryStore(), 2, 0)
+	var mut sync.Mutex
+	var errs []error
+	q.OnError = func(key string, err error) {
+		mut.Lock()
+		defer mut.Unlock()
+		errs = append(errs, err)
+	}
+	var runs int32
+	job := taskFunc(func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&runs, 1)
+	})
+	for i := 0; i < 4; i++ {
+		q.Enqueue(fmt.Sprint("account-", i), job)
+	}
+	waitFor(t, "the jobs", func() bool { return atomic.LoadInt32(&runs) == 4 })
+	mut.Lock()
+	defer mut.Unlock()
+	if len(errs) != 0 {
+		t.Errorf("got errors %v, want the parallel jobs of a type to run", errs)
+	}
+}
+
+func TestQueueQuarantine(t *testing.T) {
+	q := NewQueue(2)
+	defer q.Close()
+	q.SetQuarantine(NewMemoryStore(), 2, 0)
+	var mut sync.Mutex
+	var errs []error
+	q.OnError = func(key string, err error) {
+		mut.Lock()
+		defer mut.Unlock()
+		errs = append(errs, err)
+	}
+	errCount := func() int {
+		mut.Lock()
+		defer mut.Unlock()
+		return len(errs)
+	}
+
+	task := &poisonTask{name: "invoice-42", poisoned: true}
+	for i := 0; i < 3; i++ {
+		if err := q.Enqueue("account-1", task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a job of another name keeps running
+	other := &poisonTask{name: "invoice-43"}
+	q.Enqueue("account-1", other)
+	waitFor(t, "the jobs", func() bool { return errCount() == 3 && other.count() == 1 })
+
+	mut.Lock()
+	if errors.Is(errs[0], ErrQuarantined) || errors.Is(errs[1], ErrQuarantined) || !errors.Is(errs[2], ErrQuarantined) {
+		t.Errorf("got errors %v, want 2 panics then ErrQuarantined", errs)
+	}
+	mut.Unlock()
+	if task.count() != 2 || other.count() != 1 {
+		t.Errorf("the poison job ran %d times and the other one %d times", task.count(), other.count())
+	}
+	if quarantined := q.Quarantined(); len(quarantined) != 1 || quarantined[0] != "invoice-42" {
+		t.Fatalf("Quarantined = %v", quarantined)
+	}
+
+	task.cure()
+	if err := q.Release("invoice-42"); err != nil {
+		t.Fatal(err)
+	}
+	q.Enqueue("account-1", task)
+	waitFor(t, "the released job", func() bool { return task.count() == 3 })
+	if len(q.Quarantined()) != 0 || errCount() != 3 {
+		t.Errorf("the released job is still quarantined")
+	}
+}
@@ -0,0 +1,197 @@
+package llamatask
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueClosed is returned when enqueuing on a closed Queue
+var ErrQueueClosed = errors.New("llamatask: queue is closed")
+
+// Queue runs enqueued jobs on a pool of workers. jobs enqueued with the
+// same ordering key run one at a time in FIFO order, jobs with different
+// keys (or no key) run in parallel
+type Queue struct {
+	// OnError is called with the error of a failed FallibleTask job, and of
+	// the jobs that crashed or are quarantined when SetQuarantine is used
+	OnError func(key string, err error)
+
+	mut    sync.Mutex
+	cond   *sync.Cond
+	ready  []*keyQueue
+	keys   map[string]*keyQueue
+	closed bool
+	paused bool
+	// workers is the number of running workers, target the wanted one
+	workers, target int
+	wg              sync.WaitGroup
+	quarantine      atomic.Pointer[quarantinePolicy]
+	// crashed holds the names of the jobs that crashed or were quarantined
+	crashed map[string]bool
+}
+
+// keyQueue holds the pending jobs of an ordering key. it's in Queue.ready
+// when it has pending jobs and none of its jobs is running
+type keyQueue struct {
+	key    string
+	jobs   []interface{}
+	active bool
+}
+
+// NewQueue creates a Queue and starts its workers
+func NewQueue(workers int) *Queue {
+	q := &Queue{keys: map[string]*keyQueue{}, crashed: map[string]bool{}}
+	q.cond = sync.NewCond(&q.mut)
+	q.SetWorkers(workers)
+	return q
+}
+
+// SetWorkers changes the number of workers, extra workers stop once
+// they're done with their current job
+func (q *Queue) SetWorkers(n int) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.target = n
+	for ; q.workers < n; q.workers++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.cond.Broadcast()
+}
+
+// Pause stops the workers from starting new jobs until Resume is called,
+// Close still runs the pending jobs
+func (q *Queue) Pause() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.paused = true
+}
+
+// Resume resumes a paused Queue
+func (q *Queue) Resume() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.paused = false
+	q.cond.Broadcast()
+}
+
+// Apply applies the Workers and Paused settings to the queue
+func (q *Queue) Apply(s Settings) {
+	if s.Workers != nil {
+		q.SetWorkers(*s.Workers)
+	}
+	if s.Paused != nil && *s.Paused {
+		q.Pause()
+	} else if s.Paused != nil {
+		q.Resume()
+	}
+}
+
+// Enqueue adds a Task or FallibleTask to the queue. jobs sharing key run
+// in the order they were enqueued, an empty key means no ordering
+func (q *Queue) Enqueue(key string, t interface{}) error {
+	if !isTask(t) {
+		return ErrNotATask
+	}
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	if key == "" {
+		q.ready = append(q.ready, &keyQueue{jobs: []interface{}{t}})
+		q.cond.Signal()
+		return nil
+	}
+	kq, ok := q.keys[key]
+	if !ok {
+		kq = &keyQueue{key: key}
+		q.keys[key] = kq
+	}
+	kq.jobs = append(kq.jobs, t)
+	if !kq.active && len(kq.jobs) == 1 {
+		q.ready = append(q.ready, kq)
+		q.cond.Signal()
+	}
+	return nil
+}
+
+// Len returns the number of jobs waiting to run
+func (q *Queue) Len() int {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	n := 0
+	for _, kq := range q.ready {
+		n += len(kq.jobs)
+	}
+	for _, kq := range q.keys {
+		if kq.active {
+			n += len(kq.jobs)
+		}
+	}
+	return n
+}
+
+// Close stops accepting jobs and waits for the pending ones to run
+func (q *Queue) Close() {
+	q.mut.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mut.Unlock()
+	q.wg.Wait()
+}
+
+// work is the loop of a worker
+func (q *Queue) work() {
+	defer q.wg.Done()
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	for {
+		for (len(q.ready) == 0 || q.paused) && !q.closed && q.workers <= q.target {
+			q.cond.Wait()
+		}
+		if q.workers > q.target || len(q.ready) == 0 {
+			q.workers--
+			return
+		}
+		kq := q.ready[0]
+		q.ready = q.ready[1:]
+		job := kq.jobs[0]
+		kq.jobs = kq.jobs[1:]
+		kq.active = true
+
+		q.mut.Unlock()
+		var err error
+		if policy := q.quarantine.Load(); policy != nil {
+			err = q.runQuarantined(policy, job)
+		} else {
+			err = runJob(job)
+		}
+		if err != nil && q.OnError != nil {
+			q.OnError(kq.key, err)
+		}
+		q.mut.Lock()
+
+		kq.active = false
+		if len(kq.jobs) > 0 {
+			// back of the line so busy keys don't starve the others
+			q.ready = append(q.ready, kq)
+			q.cond.Signal()
+		} else if kq.key != "" {
+			delete(q.keys, kq.key)
+		}
+	}
+}
+
+// runJob runs a Task or a FallibleTask
+func runJob(t interface{}) error {
+	switch task := t.(type) {
+	case Task:
+		task.Run()
+	case FallibleTask:
+		return task.Run()
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrDuplicateName is returned when registering a Runner under a name that
+// is already taken
+var ErrDuplicateName = errors.New("llamatask: a runner with this name is already registered")
+
+// ErrRunnerNotFound is returned when no runner is registered under a name
+var ErrRunnerNotFound = errors.New("llamatask: runner not found")
+
+// Registry holds named runners so they can be inspected and stopped together
+type Registry struct {
+	mut     sync.Mutex
+	runners map[string]*Runner
+}
+
+// DefaultRegistry is the process-wide registry used by Register
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry initializes a new Registry
+func NewRegistry() *Registry {
+	return &Registry{runners: map[string]*Runner{}}
+}
+
+// Register adds r to the DefaultRegistry under name
+func Register(name string, r *Runner) error {
+	return DefaultRegistry.Register(name, r)
+}
+
+// Register adds r to the registry under name, it returns ErrDuplicateName
+// if the name is already used
+func (reg *Registry) Register(name string, r *Runner) error {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	if _, ok := reg.runners[name]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateName, name)
+	}
+	reg.runners[name] = r
+	return nil
+}
+
+// Unregister removes the runner registered under name
+func (reg *Registry) Unregister(name string) {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	delete(reg.runners, name)
+}
+
+// Lookup returns the runner registered under name
+func (reg *Registry) Lookup(name string) (*Runner, bool) {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	r, ok := reg.runners[name]
+	return r, ok
+}
+
+// Names returns the sorted names of the registered runners
+func (reg *Registry) Names() []string {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	names := make([]string, 0, len(reg.runners))
+	for name := range reg.runners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Status returns the status of every registered runner by name
+func (reg *Registry) Status() map[string]Status {
+	status := map[string]Status{}
+	for name, r := range reg.snapshot() {
+		status[name] = r.Status()
+	}
+	return status
+}
+
+// Healthy reports whether every registered runner is running, it returns
+// the names of the ones that aren't
+func (reg *Registry) Healthy() (bool, []string) {
+	var unhealthy []string
+	for name, r := range reg.snapshot() {
+		if !r.Status().Running {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+	sort.Strings(unhealthy)
+	return len(unhealthy) == 0, unhealthy
+}
+
+// StopAll stops every registered runner
+func (reg *Registry) StopAll() {
+	for _, r := range reg.snapshot() {
+		r.Stop()
+	}
+}
+
+// snapshot copies the runners so they can be used without holding reg.mut
+func (reg *Registry) snapshot() map[string]*Runner {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	runners := make(map[string]*Runner, len(reg.runners))
+	for name, r := range reg.runners {
+		runners[name] = r
+	}
+	return runners
+}
+
+// DrainAll drains every registered runner, it returns the report of each
+// runner that finished draining before ctx was done
+func (reg *Registry) DrainAll(ctx context.Context) (map[string]DrainReport, error) {
+	reports := map[string]DrainReport{}
+	for name, r := range reg.snapshot() {
+		report, err := r.Drain(ctx)
+		if err != nil {
+			return reports, fmt.Errorf("draining %q: %w", name, err)
+		}
+		reports[name] = report
+	}
+	return reports, nil
+}
+
+// ResumeAll resumes every registered runner
+func (reg *Registry) ResumeAll() {
+	for _, r := range reg.snapshot() {
+		r.Resume()
+	}
+}
+
+// Quarantined returns the names of the quarantined tasks of every
+// registered runner that has some
+func (reg *Registry) Quarantined() map[string][]string {
+	quarantined := map[string][]string{}
+	for name, r := range reg.snapshot() {
+		for _, h := range r.Quarantined() {
+			quarantined[name] = append(quarantined[name], h.Name())
+		}
+	}
+	return quarantined
+}
+
+// PendingApprovals returns the requests waiting for a decision in the
+// ApprovalGates of every registered runner that has some, by runner and
+// task name
+func (reg *Registry) PendingApprovals() (map[string]map[string]ApprovalRecord, error) {
+	pending := map[string]map[string]ApprovalRecord{}
+	for name, r := range reg.snapshot() {
+		for _, h := range r.Tasks() {
+			gate, ok := h.Task().(*ApprovalGate)
+			if !ok {
+				continue
+			}
+			record, ok, err := gate.Pending()
+			if err != nil {
+				return nil, fmt.Errorf("%q of %q: %w", h.Name(), name, err)
+			}
+			if !ok {
+				continue
+			}
+			if pending[name] == nil {
+				pending[name] = map[string]ApprovalRecord{}
+			}
+			pending[name][h.Name()] = record
+		}
+	}
+	return pending, nil
+}
+
+// Approve approves the pending request of the ApprovalGate named task in
+// the runner registered under runner
+func (reg *Registry) Approve(runner, task, by string) error {
+	gate, err := reg.gate(runner, task)
+	if err != nil {
+		return err
+	}
+	return gate.Approve(by)
+}
+
+// Reject rejects the pending request of the ApprovalGate named task in
+// the runner registered under runner
+func (reg *Registry) Reject(runner, task, by, reason string) error {
+	gate, err := reg.gate(runner, task)
+	if err != nil {
+		return err
+	}
+	return gate.Reject(by, reason)
+}
+
+// gate returns the ApprovalGate named task in the runner registered under runner
+func (reg *Registry) gate(runner, task string) (*ApprovalGate, error) {
+	r, ok := reg.Lookup(runner)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrRunnerNotFound, runner)
+	}
+	for _, h := range r.Tasks() {
+		if h.Name() != task {
+			continue
+		}
+		if gate, ok := h.Task().(*ApprovalGate); ok {
+			return gate, nil
+		}
+		return nil, fmt.Errorf("%w: %q doesn't require approval", ErrNoPendingApproval, task)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrTaskNotFound, task)
+}
@@ -0,0 +1,122 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistryDuplicateName(t *testing.T) {
+	reg := NewRegistry()
+	first, _ := newTestRunner(time.Minute, false)
+	second, _ := newTestRunner(time.Minute, false)
+	if err := reg.Register("ops", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Register("ops", second); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("got %v, want ErrDuplicateName", err)
+	}
+	if r, _ := reg.Lookup("ops"); r != first {
+		t.Error("the duplicate replaced the registered runner")
+	}
+
+	reg.Unregister("ops")
+	if err := reg.Register("ops", second); err != nil {
+		t.Errorf("the name wasn't freed by Unregister: %v", err)
+	}
+}
+
+func TestRegistryHealthy(t *testing.T) {
+	reg := NewRegistry()
+	running, _ := newTestRunner(time.Minute, false)
+	idle, _ := newTestRunner(time.Minute, false)
+	reg.Register("running", running)
+	reg.Register("idle", idle)
+	running.RunAsync()
+	defer running.Stop()
+	waitFor(t, "the runner to start", func() bool { return running.Status().Running })
+
+	if healthy, unhealthy := reg.Healthy(); healthy || len(unhealthy) != 1 || unhealthy[0] != "idle" {
+		t.Errorf("Healthy = %v, %v; want idle reported", healthy, unhealthy)
+	}
+	idle.RunAsync()
+	defer idle.Stop()
+	waitFor(t, "the runner to start", func() bool { return idle.Status().Running })
+	if healthy, unhealthy := reg.Healthy(); !healthy || len(unhealthy) != 0 {
+		t.Errorf("Healthy = %v, %v; want every runner healthy", healthy, unhealthy)
+	}
+}
+
+func TestRegistryShutdown(t *testing.T) {
+	reg := NewRegistry()
+	ops, _ := newTestRunner(time.Minute, true)
+	dev, _ := newTestRunner(time.Minute, true)
+	reg.Register("ops", ops)
+	reg.Register("dev", dev)
+	task := newBlockingTask()
+	ops.AddTask(task)
+	ops.tick(time.Now())
+	<-task.started
+
+	drained := make(chan map[string]DrainReport)
+	go func() {
+		reports, err := reg.DrainAll(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		drained <- reports
+	}()
+	waitFor(t, "the drain to start", ops.Draining)
+	close(task.release)
+	if reports := <-drained; len(reports) != 2 || reports["ops"].InFlight != 1 || reports["dev"].InFlight != 0 {
+		t.Errorf("got reports %+v, want the execution of ops waited for", reports)
+	}
+
+	reg.ResumeAll()
+	if ops.Draining() || dev.Draining() {
+		t.Error("the runners are still drained after ResumeAll")
+	}
+	reg.StopAll()
+	for name, status := range reg.Status() {
+		if !status.Stopped {
+			t.Errorf("%s wasn't stopped", name)
+		}
+	}
+}
+
+func TestRegistryApprovals(t *testing.T) {
+	reg := NewRegistry()
+	r, _ := newTestRunner(time.Minute, false)
+	reg.Register("ops", r)
+	task := &countTask{}
+	r.AddTask(RequireApproval(task, 0))
+	r.AddTask(&guardedScheduledTask{})
+	name := taskName(task)
+
+	r.tick(time.Now())
+	pending, err := reg.PendingApprovals()
+	if err != nil || len(pending["ops"]) != 1 {
+		t.Fatalf("got pending approvals %v, %v", pending, err)
+	}
+	if _, ok := pending["ops"][name]; !ok {
+		t.Fatalf("%q isn't pending in %v", name, pending)
+	}
+	if err := reg.Approve("ops", name, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if task.count() != 1 {
+		t.Error("the task approved through the registry didn't run")
+	}
+
+	if err := reg.Approve("dev", name, "alice"); !errors.Is(err, ErrRunnerNotFound) {
+		t.Errorf("unknown runner: got %v", err)
+	}
+	if err := reg.Reject("ops", "missing", "alice", ""); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("unknown task: got %v", err)
+	}
+	if err := reg.Approve("ops", "backup", "alice"); !errors.Is(err, ErrNoPendingApproval) {
+		t.Errorf("task without a gate: got %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+package llamatask
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaskSummary summarizes the executions of a task over a period
+type TaskSummary struct {
+	Task        string            `json:"task"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Executions  int               `json:"executions"`
+	Failed      int               `json:"failed"`
+	Skipped     int               `json:"skipped"`
+	FailureRate float64           `json:"failure_rate"`
+	P50         time.Duration     `json:"p50"`
+	P95         time.Duration     `json:"p95"`
+	Longest     time.Duration     `json:"longest"`
+}
+
+// Summary is the report of all the tasks of a Runner over a period
+type Summary struct {
+	From  time.Time     `json:"from"`
+	To    time.Time     `json:"to"`
+	Tasks []TaskSummary `json:"tasks"`
+	// LongestRunning and MostSkipped name the tasks standing out, if any
+	LongestRunning string `json:"longest_running,omitempty"`
+	MostSkipped    string `json:"most_skipped,omitempty"`
+}
+
+// Summarize builds a Summary of the executions in the history of r that
+// started in [from, to). the history only holds the last executions, see
+// SetHistorySize, ReportTask aggregates them as they happen instead
+func Summarize(r *Runner, from, to time.Time) Summary {
+	st := newStats(from)
+	for _, e := range r.History() {
+		if e.Started.Before(from) || !e.Started.Before(to) {
+			continue
+		}
+		st.add(e)
+	}
+	return st.summary(to)
+}
+
+// stats aggregates executions for a Summary
+type stats struct {
+	from  time.Time
+	tasks map[string]*taskStats
+}
+
+type taskStats struct {
+	summary   TaskSummary
+	durations durationHistogram
+}
+
+func newStats(from time.Time) *stats {
+	return &stats{from: from, tasks: map[string]*taskStats{}}
+}
+
+func (st *stats) add(e Execution) {
+	name := e.Task.Name()
+	ts, ok := st.tasks[name]
+	if !ok {
+		ts = &taskStats{summary: TaskSummary{Task: name, Labels: e.Task.Labels()}}
+		st.tasks[name] = ts
+	}
+	ts.summary.Executions++
+	switch e.Outcome {
+	case OutcomeFailed:
+		ts.summary.Failed++
+	case OutcomeSkipped:
+		ts.summary.Skipped++
+		return
+	}
+	ts.durations.add(e.Duration)
+}
+
+// merge adds the executions of other to st
+func (st *stats) merge(other *stats) {
+	for name, o := range other.tasks {
+		ts, ok := st.tasks[name]
+		if !ok {
+			st.tasks[name] = o
+			continue
+		}
+		ts.summary.Executions += o.summary.Executions
+		ts.summary.Failed += o.summary.Failed
+		ts.summary.Skipped += o.summary.Skipped
+		ts.durations.merge(&o.durations)
+	}
+}
+
+// summary returns the Summary of the executions added until to
+func (st *stats) summary(to time.Time) Summary {
+	s := Summary{From: st.from, To: to}
+	var longest time.Duration
+	mostSkipped := 0
+	for name, task := range st.tasks {
+		ts := task.summary
+		if ran := ts.Executions - ts.Skipped; ran > 0 {
+			ts.FailureRate = float64(ts.Failed) / float64(ran)
+		}
+		ts.P50, ts.P95, ts.Longest = task.durations.percentile(50), task.durations.percentile(95), task.durations.max
+		if ts.Longest > longest {
+			longest, s.LongestRunning = ts.Longest, name
+		}
+		if ts.Skipped > mostSkipped {
+			mostSkipped, s.MostSkipped = ts.Skipped, name
+		}
+		s.Tasks = append(s.Tasks, ts)
+	}
+	sort.Slice(s.Tasks, func(i, j int) bool { return s.Tasks[i].Task < s.Tasks[j].Task })
+	return s
+}
+
+// histogramGrowth is the ratio between the bounds of two consecutive
+// buckets of a durationHistogram, so its percentiles are within 2%
+const histogramGrowth = 1.02
+
+// durationHistogram counts durations in exponential buckets, it takes the
+// same memory whatever the number of executions
+type durationHistogram struct {
+	counts   map[int]int // by bucket, a bucket holds (growth^(i-1), growth^i]
+	total    int
+	min, max time.Duration
+}
+
+func (h *durationHistogram) add(d time.Duration) {
+	if h.counts == nil {
+		h.counts = map[int]int{}
+	}
+	if h.total == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.total++
+	h.counts[bucket(d)]++
+}
+
+// merge adds the durations counted by other to h
+func (h *durationHistogram) merge(other *durationHistogram) {
+	if other.total == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = map[int]int{}
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	for b, n := range other.counts {
+		h.counts[b] += n
+	}
+}
+
+// bucket returns the bucket of d, durations of zero (or less) go in the
+// lowest one
+func bucket(d time.Duration) int {
+	if d <= 0 {
+		return math.MinInt32
+	}
+	return int(math.Ceil(math.Log(float64(d)) / math.Log(histogramGrowth)))
+}
+
+// percentile returns the nearest-rank percentile p, as the upper bound of
+// its bucket
+func (h *durationHistogram) percentile(p int) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := (p*h.total + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	buckets := make([]int, 0, len(h.counts))
+	for b := range h.counts {
+		buckets = append(buckets, b)
+	}
+	sort.Ints(buckets)
+	seen := 0
+	for _, b := range buckets {
+		if seen += h.counts[b]; seen < rank {
+			continue
+		}
+		var d time.Duration
+		if b != math.MinInt32 {
+			d = time.Duration(math.Pow(histogramGrowth, float64(b)))
+		}
+		if d < h.min {
+			d = h.min
+		}
+		if d > h.max {
+			d = h.max
+		}
+		return d
+	}
+	return h.max
+}
+
+// Text renders the summary as plain text
+func (s Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Task summary %s - %s\n", s.From.Format(time.RFC3339), s.To.Format(time.RFC3339))
+	for _, ts := range s.Tasks {
+		fmt.Fprintf(&b, "%s: %d executions, %d failed (%.1f%%), %d skipped, p50 %s, p95 %s, longest %s\n",
+			ts.Task, ts.Executions, ts.Failed, ts.FailureRate*100, ts.Skipped, ts.P50, ts.P95, ts.Longest)
+	}
+	s.writeHighlights(&b, "%s: %s\n")
+	return b.String()
+}
+
+// Markdown renders the summary as a Markdown table
+func (s Summary) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Task summary %s - %s\n\n", s.From.Format(time.RFC3339), s.To.Format(time.RFC3339))
+	b.WriteString("| Task | Executions | Failed | Failure rate | Skipped | p50 | p95 | Longest |\n")
+	b.WriteString("|---|---:|---:|---:|---:|---:|---:|---:|\n")
+	for _, ts := range s.Tasks {
+		fmt.Fprintf(&b, "| %s | %d | %d | %.1f%% | %d | %s | %s | %s |\n",
+			ts.Task, ts.Executions, ts.Failed, ts.FailureRate*100, ts.Skipped, ts.P50, ts.P95, ts.Longest)
+	}
+	b.WriteString("\n")
+	s.writeHighlights(&b, "- **%s**: %s\n")
+	return b.String()
+}
+
+func (s Summary) writeHighlights(w io.Writer, format string) {
+	if s.LongestRunning != "" {
+		fmt.Fprintf(w, format, "Longest running", s.LongestRunning)
+	}
+	if s.MostSkipped != "" {
+		fmt.Fprintf(w, format, "Most skipped", s.MostSkipped)
+	}
+}
+
+// JSON renders the summary as JSON
+func (s Summary) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// ReportSink delivers summaries
+type ReportSink interface {
+	Deliver(s Summary) error
+}
+
+// ReportFormat is the format a WriterSink renders summaries in
+type ReportFormat int
+
+const (
+	FormatText ReportFormat = iota
+	FormatMarkdown
+	FormatJSON
+)
+
+// WriterSink writes summaries to W in the given format
+type WriterSink struct {
+	W      io.Writer
+	Format ReportFormat
+}
+
+// Deliver writes s to the writer
+func (w WriterSink) Deliver(s Summary) error {
+	var out []byte
+	switch w.Format {
+	case FormatMarkdown:
+		out = []byte(s.Markdown())
+	case FormatJSON:
+		var err error
+		if out, err = s.JSON(); err != nil {
+			return err
+		}
+	default:
+		out = []byte(s.Text())
+	}
+	_, err := w.W.Write(out)
+	return err
+}
+
+// ReportTask is a task that delivers a Summary of a Runner every Period,
+// like 24h for a daily or 7*24h for a weekly report. the executions are
+// aggregated as they're recorded, whatever the size of the history
+type ReportTask struct {
+	runner *Runner
+	Period time.Duration
+	Sink   ReportSink
+
+	mut   sync.Mutex
+	stats *stats
+}
+
+// NewReportTask creates a ReportTask summarizing r, the first period starts now
+func NewReportTask(r *Runner, period time.Duration, sink ReportSink) *ReportTask {
+	t := &ReportTask{runner: r, Period: period, Sink: sink, stats: newStats(time.Now())}
+	r.onRecord(t.add)
+	return t
+}
+
+// Name returns the name of the task
+func (t *ReportTask) Name() string {
+	return "report"
+}
+
+func (t *ReportTask) add(e Execution) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.stats.add(e)
+}
+
+// Run delivers the summary of the last period once it's over
+func (t *ReportTask) Run() error {
+	now := time.Now()
+	t.mut.Lock()
+	if now.Sub(t.stats.from) < t.Period {
+		t.mut.Unlock()
+		return nil
+	}
+	st := t.stats
+	t.stats = newStats(now)
+	t.mut.Unlock()
+	if err := t.Sink.Deliver(st.summary(now)); err != nil {
+		// keep the period, so the next run delivers it with the executions
+		// recorded meanwhile
+		t.mut.Lock()
+		st.merge(t.stats)
+		t.stats = st
+		t.mut.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package llamatask
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// summarySink collects the delivered summaries, it fails while err is set
+type summarySink struct {
+	mut       sync.Mutex
+	summaries []Summary
+	err       error
+}
+
+func (s *summarySink) Deliver(summary Summary) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.summaries = append(s.summaries, summary)
+	return nil
+}
+
+func TestReportTaskAggregatesBeyondHistory(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetHistorySize(2)
+	r.AddTask(&countTask{})
+	r.AddTask(failingTask{errors.New("boom")})
+	sink := &summarySink{}
+	report := NewReportTask(r, time.Hour, sink)
+
+	for i := 0; i < 150; i++ {
+		r.RunOnce()
+	}
+	if err := report.Run(); err != nil || len(sink.summaries) != 0 {
+		t.Fatalf("the summary was delivered before the end of the period")
+	}
+	report.stats.from = report.stats.from.Add(-time.Hour)
+	if err := report.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(sink.summaries))
+	}
+	summary := sink.summaries[0]
+	if len(summary.Tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2", len(summary.Tasks))
+	}
+	for _, ts := range summary.Tasks {
+		if ts.Executions != 150 {
+			t.Errorf("%s: got %d executions, want 150", ts.Task, ts.Executions)
+		}
+		if failing := strings.Contains(ts.Task, "failingTask"); failing && ts.FailureRate != 1 || !failing && ts.Failed != 0 {
+			t.Errorf("%s: failed %d times", ts.Task, ts.Failed)
+		}
+	}
+
+	// the next period starts empty
+	r.RunOnce()
+	report.stats.from = report.stats.from.Add(-time.Hour)
+	report.Run()
+	if got := sink.summaries[1].Tasks[0].Executions; got != 1 {
+		t.Errorf("got %d executions in the next period, want 1", got)
+	}
+}
+
+func TestReportTaskKeepsUndelivered(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	r.AddTask(&countTask{})
+	errDown := errors.New("mail server down")
+	sink := &summarySink{err: errDown}
+	report := NewReportTask(r, time.Hour, sink)
+	from := report.stats.from
+
+	r.RunOnce()
+	report.stats.from = report.stats.from.Add(-time.Hour)
+	if err := report.Run(); !errors.Is(err, errDown) {
+		t.Fatalf("got %v, want the error of the sink", err)
+	}
+	r.RunOnce()
+	sink.err = nil
+	if err := report.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(sink.summaries))
+	}
+	summary := sink.summaries[0]
+	if !summary.From.Equal(from.Add(-time.Hour)) || len(summary.Tasks) != 1 || summary.Tasks[0].Executions != 2 {
+		t.Errorf("got summary %+v, want the undelivered period with the executions since", summary)
+	}
+}
+
+func TestSummarySkipped(t *testing.T) {
+	now := time.Now()
+	st := newStats(now)
+	busy, idle := &TaskHandle{name: "busy"}, &TaskHandle{name: "idle"}
+	st.add(Execution{Task: busy, Duration: time.Second})
+	st.add(Execution{Task: busy, Duration: 3 * time.Second, Outcome: OutcomeFailed})
+	st.add(Execution{Task: idle, Outcome: OutcomeSkipped, Reason: "paused"})
+	st.add(Execution{Task: idle, Duration: time.Millisecond})
+
+	summary := st.summary(now.Add(time.Hour))
+	if summary.LongestRunning != "busy" || summary.MostSkipped != "idle" {
+		t.Errorf("longest running %q, most skipped %q", summary.LongestRunning, summary.MostSkipped)
+	}
+	if idle := summary.Tasks[1]; idle.Executions != 2 || idle.Skipped != 1 || idle.Longest != time.Millisecond {
+		t.Errorf("idle summary %+v", idle)
+	}
+	if busy := summary.Tasks[0]; busy.FailureRate != 0.5 || busy.Longest != 3*time.Second {
+		t.Errorf("busy summary %+v", busy)
+	}
+}
+
+func TestDurationHistogram(t *testing.T) {
+	var h durationHistogram
+	for i := 1; i <= 100; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+	for _, c := range []struct {
+		p    int
+		want time.Duration
+	}{{50, 50 * time.Millisecond}, {95, 95 * time.Millisecond}, {100, 100 * time.Millisecond}} {
+		got := h.percentile(c.p)
+		if got < c.want || float64(got) > float64(c.want)*histogramGrowth {
+			t.Errorf("p%d = %s, want %s within 2%%", c.p, got, c.want)
+		}
+	}
+
+	var same durationHistogram
+	for i := 0; i < 10; i++ {
+		same.add(1234 * time.Microsecond)
+	}
+	if got := same.percentile(50); got != 1234*time.Microsecond {
+		t.Errorf("p50 of equal durations = %s", got)
+	}
+	var zero durationHistogram
+	zero.add(0)
+	if got := zero.percentile(95); got != 0 {
+		t.Errorf("p95 of zero durations = %s", got)
+	}
+}
+
+func TestSummaryFormats(t *testing.T) {
+	now := time.Now()
+	st := newStats(now)
+	st.add(Execution{Task: &TaskHandle{name: "export"}, Duration: time.Second})
+	summary := st.summary(now.Add(24 * time.Hour))
+
+	if text := summary.Text(); !strings.Contains(text, "export: 1 executions") {
+		t.Errorf("text report:\n%s", text)
+	}
+	if md := summary.Markdown(); !strings.Contains(md, "| export | 1 | 0 |") {
+		t.Errorf("markdown report:\n%s", md)
+	}
+	out, err := summary.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Summary
+	if err := json.Unmarshal(out, &decoded); err != nil || decoded.LongestRunning != "export" {
+		t.Errorf("json report %s: %v", out, err)
+	}
+}
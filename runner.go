@@ -1,10 +1,29 @@
 package llamatask
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrNotATask is returned when registering a value that implements neither
+// Task or FallibleTask
+var ErrNotATask = errors.New("llamatask: task doesn't implement Task")
+
+// ErrInvalidNesting is returned when adding a Runner as a task of itself,
+// of one of its child runners, or when it already has a parent
+var ErrInvalidNesting = errors.New("llamatask: runner can't be nested here")
+
+// ErrTaskNotFound is returned when removing a task that isn't in the Runner
+var ErrTaskNotFound = errors.New("llamatask: task not found")
+
+// nesting guards the parent of every Runner, so cycles are checked
+// without locking several runners at once
+var nesting sync.Mutex
+
 // Task is the simple interface used in the Runner.
 // the Runner calls Run on each tick
 type Task interface {
@@ -17,44 +36,215 @@ type InitilizableTask interface {
 	Initialize()
 }
 
+// TeardownTask is a Task that releases its resources in Teardown, it's
+// called when the registration of the task is rolled back
+type TeardownTask interface {
+	Task
+	Teardown()
+}
+
+// FallibleTask is like Task but reports an error, which can be classified
+// with Permanent, Transient and Skip.
+// it can have Initialize, Teardown, Name, UseState and Guards methods as well
+type FallibleTask interface {
+	Run() error
+}
+
+// ContextTask is a FallibleTask that wants the context of the Runner, the
+// Runner calls RunContext instead of Run. the context is cancelled when the
+// Runner is stopped
+type ContextTask interface {
+	FallibleTask
+	RunContext(ctx context.Context) error
+}
+
+// these are the optional methods of Task and FallibleTask
+type (
+	initializer interface{ Initialize() }
+	teardowner  interface{ Teardown() }
+	namer       interface{ Name() string }
+	stateUser   interface{ UseState(*State) }
+	guarder     interface{ Guards() []Guard }
+	rescheduler interface{ Reschedule(now time.Time) }
+	// runnerUser is implemented by the tasks of this package that manage
+	// other tasks of their Runner, like Generator
+	runnerUser interface{ useRunner(*Runner) }
+	// wrapper is implemented by the tasks of this package that wrap another
+	// task, like ApprovalGate, so it gets the tick and the context
+	wrapper interface {
+		runWrapped(ctx context.Context, scheduled time.Time) error
+	}
+)
+
+// isTask reports whether t is a Task or a FallibleTask
+func isTask(t interface{}) bool {
+	switch t.(type) {
+	case Task, FallibleTask:
+		return true
+	}
+	return false
+}
+
 // Runner is the main struct used to hold runner's configuration
 type Runner struct {
 	mut                   sync.Mutex
-	ticker                *time.Ticker
-	tasks                 []interface{}
+	ticker                tickSource
+	interval              time.Duration
+	tasks                 []*TaskHandle
 	shouldRunOnGoroutines bool
+	evMut                 sync.Mutex
+	handlers              []func(Event)
+	lastTick              time.Time
+	elapsed               func(last, now time.Time) time.Duration
+	jumpThreshold         time.Duration
+	misfire               MisfirePolicy
+	ctx                   context.Context
+	stop                  context.CancelFunc
+	running               bool
+	paused                bool
+	children              []*Runner
+	parent                *Runner
+	store                 JobStore
+	histMut               sync.Mutex
+	history               []Execution
+	recorders             []func(Execution)
+	historySize           int
+	lastExecution         uint64
+	retries               int64
+	quarantine            atomic.Pointer[quarantinePolicy]
+	budget                time.Duration
+	cursor                int
+	deferred              int
+	draining              atomic.Bool
+	dispatchMut           sync.Mutex
+	inFlight              sync.WaitGroup
+	inFlightCount         int64
+	maxConcurrency        int
+	workers               int
+	workerSlots           chan struct{}
+	schedule              *SettingsSchedule
+	activeWindow          int
 }
 
-// Run simply runs all the tasks.
-// NOTE: it blocks the current thread forever if you don't want this
+// Run simply runs all the tasks, and starts the child runners.
+// NOTE: it blocks the current thread until Stop is called if you don't want this
 //
 //	consider using RunAsync instead
 func (r *Runner) Run() { // main runner thread
-	for range r.ticker.C { // Run on each tick
+	r.mut.Lock()
+	if r.running || r.ctx.Err() != nil {
+		r.mut.Unlock()
+		return
+	}
+	r.running = true
+	for _, child := range r.children {
+		child.RunAsync()
+	}
+	r.mut.Unlock()
+	defer func() {
 		r.mut.Lock()
-		for _, task := range r.tasks {
-			if r.shouldRunOnGoroutines {
-				go task.(Task).Run()
-			} else {
-				task.(Task).Run()
-			}
-		}
+		r.running = false
 		r.mut.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case now := <-r.ticker.C(): // Run on each tick
+			r.tick(now)
+		}
+	}
+}
+
+// tick handles a tick of the ticker
+func (r *Runner) tick(now time.Time) {
+	if paused := r.tickLocked(now); paused != nil {
+		// outside of r.mut, like setPaused
+		r.pauseChildren(*paused)
 	}
 }
 
+// tickLocked is tick under r.mut, it returns the Paused setting applied by
+// the schedule if any
+func (r *Runner) tickLocked(now time.Time) *bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	run := r.checkClock(now)
+	paused := r.applySchedule(now)
+	if run && !r.paused {
+		r.runTasks(now)
+	}
+	return paused
+}
+
+// RunOnce runs all the tasks a single time
 func (r *Runner) RunOnce() {
 	r.mut.Lock()
 	defer r.mut.Unlock()
-	for _, task := range r.tasks {
+	r.runTasks(time.Now())
+}
+
+// runTasks runs every task once for the tick at scheduled, the caller must
+// hold r.mut
+func (r *Runner) runTasks(scheduled time.Time) {
+	if r.draining.Load() {
+		return
+	}
+	if !r.shouldRunOnGoroutines && r.budget > 0 {
+		r.runTasksWithBudget(scheduled)
+		return
+	}
+	for _, h := range r.tasks {
 		if r.shouldRunOnGoroutines {
-			go task.(Task).Run()
+			if h.waiting.Load() {
+				// bounds the executions waiting for a worker
+				r.skip(Execution{Task: h, Scheduled: scheduled, Started: time.Now()}, "previous execution still waiting")
+				continue
+			}
+			if r.maxConcurrency > 0 && atomic.LoadInt64(&r.inFlightCount) >= int64(r.maxConcurrency) {
+				r.skip(Execution{Task: h, Scheduled: scheduled, Started: time.Now()}, "concurrency limit reached")
+				continue
+			}
+			r.inFlight.Add(1)
+			atomic.AddInt64(&r.inFlightCount, 1)
+			h.waiting.Store(r.workerSlots != nil)
+			go func(h *TaskHandle, workers chan struct{}) {
+				defer r.inFlight.Done()
+				defer atomic.AddInt64(&r.inFlightCount, -1)
+				r.executeTick(h, scheduled, workers)
+			}(h, r.workerSlots)
 		} else {
-			task.(Task).Run()
+			r.executeSync(h, scheduled)
 		}
 	}
 }
 
+// executeSync executes h for the tick at scheduled on a synchronous Runner,
+// the caller must hold r.mut. an execution with an offset waits for it on
+// its own goroutine so r.mut isn't held meanwhile, then runs under r.mut
+// like the others
+func (r *Runner) executeSync(h *TaskHandle, scheduled time.Time) {
+	if h.offset <= 0 {
+		r.execute(h, scheduled)
+		return
+	}
+	r.inFlight.Add(1)
+	atomic.AddInt64(&r.inFlightCount, 1)
+	go func() {
+		defer r.inFlight.Done()
+		defer atomic.AddInt64(&r.inFlightCount, -1)
+		if !r.waitOffset(h, scheduled) {
+			return
+		}
+		r.mut.Lock()
+		defer r.mut.Unlock()
+		if !h.isRemoved() {
+			r.execute(h, scheduled)
+		}
+	}()
+}
+
 // RunOnceAsync runs RunOnce in a goroutine
 func (r *Runner) RunOnceAsync() {
 	go r.RunOnce()
@@ -65,30 +255,302 @@ func (r *Runner) RunAsync() {
 	go r.Run()
 }
 
-// AddTask adds a task to the Runner. and panics if t is neither Task or InitilizableTask
+// AddTask adds a task to the Runner and returns its handle.
+// it panics if t is neither Task, InitilizableTask or FallibleTask.
+// a *Runner can be added as a task, it keeps its own interval and is
+// started, paused and stopped along with this Runner
 // NOTE: it blocks until the current iteration of the loop is complete
 //
 //	if you don't want this use AddTaskAsync instead
-func (r *Runner) AddTask(t interface{}) {
-	if initilizableTask, ok := t.(InitilizableTask); ok {
-		initilizableTask.Initialize()
-	} else if _, ok := t.(Task); !ok {
+func (r *Runner) AddTask(t interface{}) *TaskHandle {
+	if !isTask(t) {
 		panic("called AddTask on a task that doesn't implement Task")
 	}
+	if err := r.attachState(t, ""); err != nil {
+		panic(fmt.Sprintf("called AddTask on a task that can't be added: %v", err))
+	}
+	if initilizableTask, ok := t.(initializer); ok {
+		initilizableTask.Initialize()
+	}
+	handles, err := r.register(registration{task: t})
+	if err != nil {
+		panic(fmt.Sprintf("called AddTask on a task that can't be added: %v", err))
+	}
+	return handles[0]
+}
+
+// AddTaskAsync adds a task to the Runner in a goroutine.
+// the returned channel receives the task handle, or ErrNotATask / the
+// panic raised by Initialize as an error, and is then closed
+func (r *Runner) AddTaskAsync(t interface{}) <-chan AddTaskResult {
+	result := make(chan AddTaskResult, 1)
+	if !isTask(t) {
+		result <- AddTaskResult{Err: ErrNotATask}
+		close(result)
+		return result
+	}
+	go func() {
+		defer close(result)
+		if err := r.initialize(t, ""); err != nil {
+			result <- AddTaskResult{Err: err}
+			return
+		}
+		handles, err := r.register(registration{task: t})
+		if err != nil {
+			teardown([]registration{{task: t}})
+			result <- AddTaskResult{Err: err}
+			return
+		}
+		result <- AddTaskResult{Handle: handles[0]}
+	}()
+	return result
+}
+
+// AddTasks initializes all the tasks and adds them to the Runner at once.
+// if a task doesn't implement Task, its Initialize panics or it can't be
+// added none of them are added, and the ones already initialized are torn down
+func (r *Runner) AddTasks(tasks ...interface{}) ([]*TaskHandle, error) {
+	regs := make([]registration, len(tasks))
+	for i, t := range tasks {
+		regs[i].task = t
+	}
+	return r.addTasks(regs)
+}
+
+// registration is a task being added to the Runner, with the options of
+// its handle
+type registration struct {
+	task interface{}
+	// name replaces the name of the task, its state is keyed by it too
+	name string
+	// offset delays the executions after each tick
+	offset time.Duration
+	labels map[string]string
+}
+
+// addTasks is AddTasks with the options of the handles
+func (r *Runner) addTasks(regs []registration) ([]*TaskHandle, error) {
+	for i, reg := range regs {
+		if !isTask(reg.task) {
+			return nil, fmt.Errorf("task %d: %w", i, ErrNotATask)
+		}
+	}
+	for i, reg := range regs {
+		if err := r.initialize(reg.task, reg.name); err != nil {
+			teardown(regs[:i])
+			return nil, fmt.Errorf("task %d: %w", i, err)
+		}
+	}
+	handles, err := r.register(regs...)
+	if err != nil {
+		teardown(regs)
+		return nil, err
+	}
+	return handles, nil
+}
+
+// teardown tears down the tasks in reverse order
+func teardown(regs []registration) {
+	for i := len(regs) - 1; i >= 0; i-- {
+		if teardownTask, ok := regs[i].task.(teardowner); ok {
+			teardownTask.Teardown()
+		}
+	}
+}
+
+// register appends already initialized tasks to the Runner, it adds none
+// of them if one can't be added
+func (r *Runner) register(regs ...registration) ([]*TaskHandle, error) {
+	nesting.Lock()
+	defer nesting.Unlock()
 	r.mut.Lock()
 	defer r.mut.Unlock()
-	r.tasks = append(r.tasks, t)
+	handles := make([]*TaskHandle, len(regs))
+	for i, reg := range regs {
+		var name string
+		var err error
+		if child, ok := reg.task.(*Runner); ok {
+			name, err = taskName(child), r.checkNesting(child, regs[:i])
+		} else {
+			name, err = r.nameTask(reg, handles[:i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("task %d: %w", i, err)
+		}
+		handles[i] = &TaskHandle{
+			runner:  r,
+			task:    reg.task,
+			name:    name,
+			offset:  reg.offset,
+			labels:  reg.labels,
+			removed: make(chan struct{}),
+		}
+	}
+
+	for i, reg := range regs {
+		if child, ok := reg.task.(*Runner); ok {
+			child.parent = r
+			r.children = append(r.children, child)
+			if r.running {
+				child.RunAsync()
+			}
+			continue
+		}
+		if user, ok := reg.task.(runnerUser); ok {
+			user.useRunner(r)
+		}
+		r.tasks = append(r.tasks, handles[i])
+	}
+	return handles, nil
 }
 
-// AddTaskAsync runs AddTask in a goroutine
-func (r *Runner) AddTaskAsync(t interface{}) {
-	go r.AddTask(r)
+// checkNesting returns ErrInvalidNesting if child can't become a child of
+// r, batch are the tasks added along with it. the caller must hold nesting
+func (r *Runner) checkNesting(child *Runner, batch []registration) error {
+	if child.parent != nil {
+		return fmt.Errorf("%w: it already has a parent", ErrInvalidNesting)
+	}
+	for _, reg := range batch {
+		if reg.task == child {
+			return fmt.Errorf("%w: it's added twice", ErrInvalidNesting)
+		}
+	}
+	for ancestor := r; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor == child {
+			return fmt.Errorf("%w: it would be its own ancestor", ErrInvalidNesting)
+		}
+	}
+	return nil
+}
+
+// nameTask returns the name of the handle of a task. a NamedTask keeps its
+// name, which must be unique in the Runner, other tasks are named after
+// their type with a #n suffix for the following tasks of the same type.
+// batch are the handles added along with it, the caller must hold r.mut
+func (r *Runner) nameTask(reg registration, batch []*TaskHandle) (string, error) {
+	taken := func(name string) bool {
+		for _, handles := range [][]*TaskHandle{r.tasks, batch} {
+			for _, h := range handles {
+				if h.name == name {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	name := reg.name
+	if namedTask, ok := reg.task.(namer); ok && name == "" {
+		name = namedTask.Name()
+	}
+	if name != "" {
+		if taken(name) {
+			return "", fmt.Errorf("%w: %q", ErrDuplicateTask, name)
+		}
+		return name, nil
+	}
+	name = fmt.Sprintf("%T", reg.task)
+	for n := 2; taken(name); n++ {
+		name = fmt.Sprintf("%T#%d", reg.task, n)
+	}
+	return name, nil
+}
+
+// RemoveTask removes a task from the Runner and tears it down if it's a
+// TeardownTask, a removed child Runner is stopped. an execution in
+// progress isn't interrupted, but a delayed one doesn't start anymore
+// NOTE: it blocks until the current iteration of the loop is complete
+func (r *Runner) RemoveTask(h *TaskHandle) error {
+	nesting.Lock()
+	r.mut.Lock()
+	found := false
+	if child, ok := h.task.(*Runner); ok {
+		for i, c := range r.children {
+			if c == child {
+				r.children = append(r.children[:i:i], r.children[i+1:]...)
+				child.parent = nil
+				found = true
+				break
+			}
+		}
+	} else {
+		for i, t := range r.tasks {
+			if t == h {
+				r.removeAt(i)
+				found = true
+				break
+			}
+		}
+	}
+	if found {
+		// under r.mut, so an execution that takes r.mut sees the removal
+		close(h.removed)
+	}
+	r.mut.Unlock()
+	nesting.Unlock()
+	if !found {
+		return ErrTaskNotFound
+	}
+
+	if child, ok := h.task.(*Runner); ok {
+		child.Stop()
+	} else if teardownTask, ok := h.task.(teardowner); ok {
+		teardownTask.Teardown()
+	}
+	return nil
+}
+
+// removeAt removes the task at i, keeping the cursor and the deferred
+// tasks of the tick budget on the same tasks. the caller must hold r.mut
+func (r *Runner) removeAt(i int) {
+	n := len(r.tasks)
+	if (i-r.cursor+n)%n < r.deferred {
+		r.deferred--
+	}
+	if i < r.cursor {
+		r.cursor--
+	}
+	r.tasks = append(r.tasks[:i:i], r.tasks[i+1:]...)
+	if r.cursor >= len(r.tasks) {
+		r.cursor = 0
+	}
+}
+
+// initialize gives t its state, keyed by name if it's set, and calls
+// Initialize on t if it's an InitilizableTask. the panic raised by
+// Initialize is returned as an error
+func (r *Runner) initialize(t interface{}, name string) (err error) {
+	if err := r.attachState(t, name); err != nil {
+		return err
+	}
+	initilizableTask, ok := t.(initializer)
+	if !ok {
+		return nil
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("llamatask: initializing task: %v", p)
+		}
+	}()
+	initilizableTask.Initialize()
+	return nil
 }
 
 // NewRunner initializes a new Runner
 func NewRunner(interval time.Duration, shouldRunOnGoroutines bool) Runner {
+	return newRunner(timeTicker{time.NewTicker(interval)}, interval, shouldRunOnGoroutines)
+}
+
+func newRunner(ticker tickSource, interval time.Duration, shouldRunOnGoroutines bool) Runner {
+	ctx, stop := context.WithCancel(context.Background())
 	return Runner{
-		ticker:                time.NewTicker(interval),
+		ctx:                   ctx,
+		stop:                  stop,
+		ticker:                ticker,
+		interval:              interval,
+		elapsed:               monotonicElapsed,
+		jumpThreshold:         DefaultClockJumpThreshold,
+		store:                 NewMemoryStore(),
+		historySize:           DefaultHistorySize,
 		shouldRunOnGoroutines: shouldRunOnGoroutines,
 	}
 }
@@ -0,0 +1,199 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTicker is a tickSource whose ticks are sent by the test
+type fakeTicker struct {
+	c      chan time.Time
+	resets int32
+}
+
+func newFakeTicker() *fakeTicker {
+	return &fakeTicker{c: make(chan time.Time)}
+}
+
+func (f *fakeTicker) C() <-chan time.Time { return f.c }
+func (f *fakeTicker) Reset(time.Duration) { atomic.AddInt32(&f.resets, 1) }
+func (f *fakeTicker) Stop()               {}
+
+// newTestRunner returns a Runner driven by a fakeTicker. the monotonic
+// clock always advances by exactly one interval between ticks, so a tick
+// whose wall time moved further simulates a clock jump
+func newTestRunner(interval time.Duration, shouldRunOnGoroutines bool) (*Runner, *fakeTicker) {
+	ticker := newFakeTicker()
+	r := newRunner(ticker, interval, shouldRunOnGoroutines)
+	r.elapsed = func(last, now time.Time) time.Duration { return interval }
+	return &r, ticker
+}
+
+// countTask counts its runs
+type countTask struct {
+	runs int64
+}
+
+func (t *countTask) Run() { atomic.AddInt64(&t.runs, 1) }
+
+func (t *countTask) count() int { return int(atomic.LoadInt64(&t.runs)) }
+
+// eventLog records the events of a Runner
+type eventLog struct {
+	mut    sync.Mutex
+	events []Event
+}
+
+func recordEvents(r *Runner) *eventLog {
+	log := &eventLog{}
+	r.OnEvent(func(e Event) {
+		log.mut.Lock()
+		defer log.mut.Unlock()
+		log.events = append(log.events, e)
+	})
+	return log
+}
+
+func (l *eventLog) kind(kind EventKind) []Event {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	var events []Event
+	for _, e := range l.events {
+		if e.Kind == kind {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// tickUntil sends a tick to the Runner until done is closed
+func tickUntil(ticker *fakeTicker, done <-chan struct{}) {
+	for {
+		select {
+		case ticker.c <- time.Now():
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestAddTaskAsyncDuringTicks(t *testing.T) {
+	r, ticker := newTestRunner(time.Millisecond, true)
+	go r.Run()
+	defer r.Stop()
+	done := make(chan struct{})
+	go tickUntil(ticker, done)
+
+	const n = 50
+	tasks := make([]*countTask, n)
+	results := make([]<-chan AddTaskResult, n)
+	for i := range tasks {
+		tasks[i] = &countTask{}
+		results[i] = r.AddTaskAsync(tasks[i])
+	}
+	for i, result := range results {
+		res := <-result
+		if res.Err != nil || res.Handle == nil {
+			t.Fatalf("task %d: got %+v, want a handle", i, res)
+		}
+		if res.Handle.Task() != tasks[i] {
+			t.Errorf("task %d: handle of another task", i)
+		}
+		if _, ok := <-result; ok {
+			t.Errorf("task %d: result channel not closed", i)
+		}
+	}
+	if got := len(r.Tasks()); got != n {
+		t.Fatalf("%d tasks registered, want %d", got, n)
+	}
+
+	// every task runs on the ticks after its registration, the loop only
+	// takes the second tick once it's done with the first
+	close(done)
+	ticker.c <- time.Now()
+	ticker.c <- time.Now()
+	if _, err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, task := range tasks {
+		if task.count() == 0 {
+			t.Errorf("task %d never ran", i)
+		}
+	}
+}
+
+type panickingTask struct {
+	countTask
+}
+
+func (t *panickingTask) Initialize() { panic("no database") }
+
+func TestAddTaskAsyncInitializePanics(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	res := <-r.AddTaskAsync(&panickingTask{})
+	if res.Err == nil || res.Handle != nil {
+		t.Fatalf("got %+v, want an error", res)
+	}
+	if !strings.Contains(res.Err.Error(), "no database") {
+		t.Errorf("error %q doesn't contain the panic", res.Err)
+	}
+	if got := len(r.Tasks()); got != 0 {
+		t.Errorf("%d tasks registered, want 0", got)
+	}
+}
+
+func TestAddTaskAsyncNotATask(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	res := <-r.AddTaskAsync(struct{}{})
+	if !errors.Is(res.Err, ErrNotATask) {
+		t.Fatalf("got %v, want ErrNotATask", res.Err)
+	}
+}
+
+// loggedTask logs its initialization and teardown
+type loggedTask struct {
+	countTask
+	name string
+	log  *[]string
+}
+
+func (t *loggedTask) Name() string { return t.name }
+func (t *loggedTask) Initialize()  { *t.log = append(*t.log, "initialize "+t.name) }
+func (t *loggedTask) Teardown()    { *t.log = append(*t.log, "teardown "+t.name) }
+
+func TestAddTasksRollsBack(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	var log []string
+	_, err := r.AddTasks(&loggedTask{name: "a", log: &log}, &loggedTask{name: "b", log: &log}, &panickingTask{})
+	if err == nil || !strings.Contains(err.Error(), "no database") {
+		t.Fatalf("got %v, want the panic of Initialize", err)
+	}
+	want := []string{"initialize a", "initialize b", "teardown b", "teardown a"}
+	if strings.Join(log, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %q, want %q", log, want)
+	}
+	if got := len(r.Tasks()); got != 0 {
+		t.Errorf("%d tasks registered, want 0", got)
+	}
+
+	// registering fails after every task was initialized
+	log = nil
+	r.AddTask(&loggedTask{name: "c", log: &log})
+	log = nil
+	_, err = r.AddTasks(&loggedTask{name: "a", log: &log}, &loggedTask{name: "c", log: &log})
+	if !errors.Is(err, ErrDuplicateTask) {
+		t.Fatalf("got %v, want ErrDuplicateTask", err)
+	}
+	want = []string{"initialize a", "initialize c", "teardown c", "teardown a"}
+	if strings.Join(log, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got %q, want %q", log, want)
+	}
+	if got := taskNames(r); len(got) != 1 || got[0] != "c" {
+		t.Errorf("tasks = %v, want none of the batch registered", got)
+	}
+}
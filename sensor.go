@@ -0,0 +1,123 @@
+package llamatask
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SensorMode decides how a Sensor waits for its condition
+type SensorMode int
+
+const (
+	// SensorReschedule checks the condition once per tick of the Runner
+	// (at most once per Interval) and returns right away, so a waiting
+	// sensor doesn't hold the goroutine running the tasks
+	SensorReschedule SensorMode = iota
+	// SensorPoke keeps checking the condition every Interval until it's
+	// satisfied or the timeout expires, blocking the goroutine meanwhile
+	SensorPoke
+)
+
+// Sensor is a task that waits for a condition and then triggers other
+// registered tasks. once it triggered or timed out it starts waiting again.
+// an execution fails with the error of the condition if it couldn't be
+// checked, in poke mode with the last error once the sensor stops poking
+type Sensor struct {
+	Condition func(ctx context.Context) (bool, error)
+	Mode      SensorMode
+	Interval  time.Duration
+	// Timeout is how long to wait for the condition, zero waits forever
+	Timeout time.Duration
+	Targets []*TaskHandle
+	// OnTimeout is called when the condition wasn't satisfied in time
+	OnTimeout func()
+
+	mut      sync.Mutex
+	busy     bool
+	since    time.Time
+	lastPoke time.Time
+}
+
+// NewSensor creates a Sensor that triggers targets once condition is true
+func NewSensor(condition func(ctx context.Context) (bool, error), mode SensorMode, interval, timeout time.Duration, targets ...*TaskHandle) *Sensor {
+	return &Sensor{
+		Condition: condition,
+		Mode:      mode,
+		Interval:  interval,
+		Timeout:   timeout,
+		Targets:   targets,
+	}
+}
+
+// Run checks the condition according to the mode of the sensor, it's used
+// when the Sensor is run outside of a Runner
+func (s *Sensor) Run() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext checks the condition according to the mode of the sensor,
+// poking stops when ctx is done
+func (s *Sensor) RunContext(ctx context.Context) error {
+	s.mut.Lock()
+	if s.busy { // still poking from a previous tick
+		s.mut.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if s.since.IsZero() {
+		s.since = now
+	}
+	if s.Mode == SensorReschedule && now.Sub(s.lastPoke) < s.Interval {
+		s.mut.Unlock()
+		return nil
+	}
+	s.busy = true
+	since := s.since
+	s.mut.Unlock()
+
+	satisfied, err := s.poke(ctx, since)
+	s.mut.Lock()
+	s.busy = false
+	timedOut := !satisfied && s.Timeout > 0 && time.Since(since) >= s.Timeout
+	if satisfied || timedOut {
+		s.since = time.Time{}
+	}
+	s.mut.Unlock()
+
+	if satisfied {
+		for _, target := range s.Targets {
+			target.Trigger()
+		}
+	} else if timedOut && s.OnTimeout != nil {
+		s.OnTimeout()
+	}
+	return err
+}
+
+// poke checks the condition once, or until the timeout in poke mode. it
+// returns the last error of the condition if it wasn't satisfied
+func (s *Sensor) poke(ctx context.Context, since time.Time) (bool, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, since.Add(s.Timeout))
+		defer cancel()
+	}
+	for {
+		s.mut.Lock()
+		s.lastPoke = time.Now()
+		s.mut.Unlock()
+		ok, err := s.Condition(ctx)
+		if err == nil && ok {
+			return true, nil
+		}
+		if s.Mode != SensorPoke {
+			return false, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, err
+		case <-time.After(s.Interval):
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package llamatask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSensorTriggersTargets(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	target := &countTask{}
+	h := r.AddTask(target)
+	ready := false
+	r.AddTask(NewSensor(func(context.Context) (bool, error) { return ready, nil }, SensorReschedule, 0, 0, h))
+
+	r.tick(time.Now())
+	if target.count() != 1 { // it ran on its own tick only
+		t.Fatalf("target ran %d times, want 1", target.count())
+	}
+	ready = true
+	r.tick(time.Now())
+	if target.count() != 3 {
+		t.Errorf("target ran %d times, want 3 with the trigger", target.count())
+	}
+}
+
+func TestSensorReportsConditionErrors(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	events := recordEvents(r)
+	errDown := errors.New("bucket unreachable")
+	r.AddTask(NewSensor(func(context.Context) (bool, error) { return false, errDown }, SensorReschedule, 0, 0))
+	r.tick(time.Now())
+	failures := events.kind(EventFailure)
+	if len(failures) != 1 || !errors.Is(failures[0].Err, errDown) {
+		t.Errorf("failures = %+v, want the condition error", failures)
+	}
+}
+
+func TestSensorPokeStopsWithRunner(t *testing.T) {
+	r, ticker := newTestRunner(time.Minute, false)
+	poked := make(chan struct{}, 1)
+	r.AddTask(NewSensor(func(context.Context) (bool, error) {
+		select {
+		case poked <- struct{}{}:
+		default:
+		}
+		return false, nil
+	}, SensorPoke, time.Millisecond, 0))
+
+	stopped := make(chan struct{})
+	go func() {
+		r.Run()
+		close(stopped)
+	}()
+	ticker.c <- time.Now()
+	<-poked
+
+	go r.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop didn't interrupt a poking sensor")
+	}
+}
@@ -0,0 +1,183 @@
+package llamatask
+
+import (
+	"sync"
+	"time"
+)
+
+// Settings are runtime settings of a Runner or a Queue, nil fields are
+// left unchanged when the settings are applied
+type Settings struct {
+	Paused *bool
+	// MaxConcurrency caps the executions running at once in goroutine
+	// mode, the executions over the cap are skipped. zero means no cap
+	MaxConcurrency *int
+	TickBudget     *time.Duration
+	// Workers is the number of workers of a Queue, or of a Runner in
+	// goroutine mode (see Runner.SetWorkers)
+	Workers *int
+}
+
+// SettingsWindow applies Settings during a time of the day. Start and End
+// are offsets from midnight, a window with End before Start spans midnight
+type SettingsWindow struct {
+	Start, End time.Duration
+	// Weekdays limits the window to some days, empty means every day
+	Weekdays []time.Weekday
+	Settings Settings
+}
+
+// SettingsSchedule changes settings across the day, the first window
+// containing the current time wins and Default applies outside of them
+type SettingsSchedule struct {
+	Default  Settings
+	Windows  []SettingsWindow
+	Location *time.Location // defaults to time.Local
+}
+
+// active returns the index of the window containing t, or -1
+func (s *SettingsSchedule) active(t time.Time) int {
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	// the wall clock time, t.Sub(midnight) is off by an hour on DST days
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	for i, w := range s.Windows {
+		if !w.onDay(t.Weekday()) {
+			continue
+		}
+		if w.Start <= w.End && offset >= w.Start && offset < w.End ||
+			w.Start > w.End && (offset >= w.Start || offset < w.End) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (w SettingsWindow) onDay(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// At returns the settings that apply at t
+func (s *SettingsSchedule) At(t time.Time) Settings {
+	if i := s.active(t); i >= 0 {
+		return s.Windows[i].Settings
+	}
+	return s.Default
+}
+
+// SetMaxConcurrency caps the executions running at once in goroutine mode,
+// the executions over the cap are skipped. zero removes the cap
+func (r *Runner) SetMaxConcurrency(n int) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.maxConcurrency = n
+}
+
+// SetWorkers limits the executions running at once in goroutine mode to n
+// workers, the executions over it wait for a free worker where the
+// concurrency cap skips them. a task waits with one execution at most, its
+// next ones are skipped meanwhile. the executions already running when the
+// limit changes aren't counted in the new one. zero removes the limit
+func (r *Runner) SetWorkers(n int) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.setWorkers(n)
+}
+
+// setWorkers replaces the worker slots, the caller must hold r.mut
+func (r *Runner) setWorkers(n int) {
+	if n == r.workers {
+		return
+	}
+	r.workers, r.workerSlots = n, nil
+	if n > 0 {
+		r.workerSlots = make(chan struct{}, n)
+	}
+}
+
+// SetSettingsSchedule makes the Runner apply the settings of s on each
+// tick where the active window changes, settings changed by hand in
+// between are kept until the next change. nil removes the schedule
+func (r *Runner) SetSettingsSchedule(s *SettingsSchedule) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.schedule = s
+	r.activeWindow = -2 // apply on the next tick
+}
+
+// applySchedule applies the settings of the schedule if the active window
+// changed, the caller must hold r.mut. it returns the Paused setting, which
+// the caller applies to the child runners once it released r.mut
+func (r *Runner) applySchedule(now time.Time) *bool {
+	if r.schedule == nil {
+		return nil
+	}
+	i := r.schedule.active(now)
+	if i == r.activeWindow {
+		return nil
+	}
+	r.activeWindow = i
+	s := r.schedule.At(now)
+	if s.Paused != nil {
+		r.paused = *s.Paused
+	}
+	if s.MaxConcurrency != nil {
+		r.maxConcurrency = *s.MaxConcurrency
+	}
+	if s.TickBudget != nil {
+		r.budget = *s.TickBudget
+	}
+	if s.Workers != nil {
+		r.setWorkers(*s.Workers)
+	}
+	return s.Paused
+}
+
+// pauseChildren pauses or resumes the runners under r, unlike Resume it
+// doesn't end their draining
+func (r *Runner) pauseChildren(paused bool) {
+	for _, child := range r.Children() {
+		child.mut.Lock()
+		child.paused = paused
+		child.mut.Unlock()
+		child.pauseChildren(paused)
+	}
+}
+
+// SettingsTask applies a SettingsSchedule through a function whenever the
+// active window changes, like Queue.Apply to drive a Queue from a Runner
+type SettingsTask struct {
+	schedule *SettingsSchedule
+	apply    func(Settings)
+
+	mut    sync.Mutex
+	active int
+}
+
+// NewSettingsTask creates a SettingsTask
+func NewSettingsTask(s *SettingsSchedule, apply func(Settings)) *SettingsTask {
+	return &SettingsTask{schedule: s, apply: apply, active: -2}
+}
+
+// Run applies the settings if the active window changed
+func (t *SettingsTask) Run() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	now := time.Now()
+	if i := t.schedule.active(now); i != t.active {
+		t.active = i
+		t.apply(t.schedule.At(now))
+	}
+}
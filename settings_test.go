@@ -0,0 +1,222 @@
+package llamatask
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSettingsScheduleDST(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	s := &SettingsSchedule{
+		Windows:  []SettingsWindow{{Start: 9 * time.Hour, End: 17 * time.Hour}},
+		Location: loc,
+	}
+	for _, c := range []struct {
+		at   time.Time
+		want int
+	}{
+		// the days are 23 and 25 hours long
+		{time.Date(2026, 3, 8, 9, 30, 0, 0, loc), 0},
+		{time.Date(2026, 3, 8, 17, 30, 0, 0, loc), -1},
+		{time.Date(2026, 11, 1, 16, 30, 0, 0, loc), 0},
+		{time.Date(2026, 11, 1, 8, 30, 0, 0, loc), -1},
+	} {
+		if got := s.active(c.at); got != c.want {
+			t.Errorf("active(%s) = %d, want %d", c.at, got, c.want)
+		}
+	}
+}
+
+func TestSettingsScheduleSpansMidnight(t *testing.T) {
+	s := &SettingsSchedule{
+		Windows: []SettingsWindow{{
+			Start: 22 * time.Hour, End: 6 * time.Hour,
+			Weekdays: []time.Weekday{time.Friday, time.Saturday},
+		}},
+		Location: time.UTC,
+	}
+	friday := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		at   time.Time
+		want int
+	}{
+		{friday.Add(23 * time.Hour), 0},
+		{friday.Add(26 * time.Hour), 0},  // saturday 2am
+		{friday.Add(12 * time.Hour), -1}, // friday noon
+		{friday.Add(-time.Hour), -1},     // thursday 11pm
+	} {
+		if got := s.active(c.at); got != c.want {
+			t.Errorf("active(%s) = %d, want %d", c.at, got, c.want)
+		}
+	}
+}
+
+func TestSettingsSchedulePausesChildren(t *testing.T) {
+	parent, _ := newTestRunner(time.Minute, false)
+	child, _ := newTestRunner(time.Minute, false)
+	grandchild, _ := newTestRunner(time.Minute, false)
+	child.AddTask(grandchild)
+	parent.AddTask(child)
+
+	paused, resumed := true, false
+	parent.SetSettingsSchedule(&SettingsSchedule{Default: Settings{Paused: &paused}})
+	parent.tick(time.Now())
+	if status := parent.Status(); !status.Paused || !status.Children[0].Paused || !status.Children[0].Children[0].Paused {
+		t.Fatalf("status = %+v, want the whole tree paused", status)
+	}
+
+	parent.SetSettingsSchedule(&SettingsSchedule{Default: Settings{Paused: &resumed}})
+	parent.tick(time.Now())
+	if status := parent.Status(); status.Paused || status.Children[0].Paused || status.Children[0].Children[0].Paused {
+		t.Errorf("status = %+v, want the whole tree resumed", status)
+	}
+}
+
+func TestMaxConcurrencyRecordsSkips(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	events := recordEvents(r)
+	first, second := newBlockingTask(), newBlockingTask()
+	r.AddTask(first)
+	h := r.AddTask(second)
+	limit := 1
+	r.SetSettingsSchedule(&SettingsSchedule{Default: Settings{MaxConcurrency: &limit}})
+
+	r.tick(time.Now())
+	<-first.started
+	close(first.release)
+	close(second.release)
+	r.inFlight.Wait()
+
+	if stats := h.Stats(); stats.Executions != 1 || stats.Skipped != 1 {
+		t.Errorf("stats = %+v, want the skip counted", stats)
+	}
+	if skips := events.kind(EventSkip); len(skips) != 1 || skips[0].Reason != "concurrency limit reached" {
+		t.Errorf("got skip events %+v", skips)
+	}
+	var skipped []Execution
+	for _, e := range r.History() {
+		if e.Outcome == OutcomeSkipped {
+			skipped = append(skipped, e)
+		}
+	}
+	if len(skipped) != 1 || skipped[0].Task != h {
+		t.Errorf("got skipped executions %+v, want the one over the cap", skipped)
+	}
+}
+
+func TestRunnerWorkers(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	first, second := newBlockingTask(), newBlockingTask()
+	r.AddTask(first)
+	r.AddTask(second)
+	workers := 1
+	r.SetSettingsSchedule(&SettingsSchedule{Default: Settings{Workers: &workers}})
+
+	r.tick(time.Now())
+	var waiting *blockingTask
+	select {
+	case <-first.started:
+		waiting = second
+		close(first.release)
+	case <-second.started:
+		waiting = first
+		close(second.release)
+	}
+	select {
+	case <-waiting.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the waiting execution didn't run once the worker was free")
+	}
+	close(waiting.release)
+	r.inFlight.Wait()
+	for _, e := range r.History() {
+		if e.Outcome != OutcomeCompleted {
+			t.Errorf("got %s execution, want the executions over the limit to wait", e.Outcome)
+		}
+	}
+}
+
+func TestRunnerWorkersLimit(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	r.SetWorkers(2)
+	var mut sync.Mutex
+	running, max := 0, 0
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		r.AddTask(taskFunc(func() {
+			mut.Lock()
+			if running++; running > max {
+				max = running
+			}
+			mut.Unlock()
+			<-release
+			mut.Lock()
+			running--
+			mut.Unlock()
+		}))
+	}
+	r.tick(time.Now())
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	r.inFlight.Wait()
+	if max != 2 {
+		t.Errorf("%d executions ran at once, want 2", max)
+	}
+}
+
+func TestRunnerWorkersBacklog(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	r.SetWorkers(1)
+	events := recordEvents(r)
+	task := newBlockingTask()
+	h := r.AddTask(task)
+
+	r.tick(time.Now())
+	<-task.started
+	// the second execution waits for the worker, the next ones are skipped
+	for i := 0; i < 3; i++ {
+		r.tick(time.Now())
+	}
+	if skips := events.kind(EventSkip); len(skips) != 2 || skips[0].Reason != "previous execution still waiting" {
+		t.Errorf("got skips %+v, want the 2 executions after the waiting one", skips)
+	}
+	close(task.release)
+	r.inFlight.Wait()
+	if n := len(events.kind(EventSkip)); n != 2 {
+		t.Errorf("got %d skips once the worker was free, want 2", n)
+	}
+	if stats := h.Stats(); stats.Completed != 2 || stats.Skipped != 2 {
+		t.Errorf("got stats %+v, want the running and the waiting executions completed", stats)
+	}
+
+	// the next tick doesn't wait anymore
+	r.tick(time.Now())
+	r.inFlight.Wait()
+	if n := len(events.kind(EventSkip)); n != 2 {
+		t.Errorf("got %d skips after the backlog was done, want 2", n)
+	}
+}
+
+// taskFunc is a Task running f
+type taskFunc func()
+
+func (f taskFunc) Run() { f() }
+
+func TestSettingsTask(t *testing.T) {
+	var applied int32
+	task := NewSettingsTask(&SettingsSchedule{}, func(Settings) { atomic.AddInt32(&applied, 1) })
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task.Run()
+		}()
+	}
+	wg.Wait()
+	if applied != 1 {
+		t.Errorf("the settings were applied %d times, want once", applied)
+	}
+}
@@ -0,0 +1,295 @@
+package llamatask
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+)
+
+// Distribution gives the durations of the simulated executions of a task
+type Distribution interface {
+	Sample(rng *rand.Rand) time.Duration
+}
+
+// Fixed is a Distribution that always returns the same duration
+type Fixed time.Duration
+
+// Sample returns d
+func (d Fixed) Sample(*rand.Rand) time.Duration {
+	return time.Duration(d)
+}
+
+// Uniform is a Distribution of durations uniformly spread in [Min, Max)
+type Uniform struct {
+	Min, Max time.Duration
+}
+
+// Sample returns a random duration between Min and Max
+func (d Uniform) Sample(rng *rand.Rand) time.Duration {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + time.Duration(rng.Int63n(int64(d.Max-d.Min)))
+}
+
+// Normal is a normal Distribution of durations, negative samples are 0
+type Normal struct {
+	Mean, StdDev time.Duration
+}
+
+// Sample returns a random duration around Mean
+func (d Normal) Sample(rng *rand.Rand) time.Duration {
+	sample := time.Duration(rng.NormFloat64()*float64(d.StdDev)) + d.Mean
+	if sample < 0 {
+		return 0
+	}
+	return sample
+}
+
+// SimulatedTask is a task of a simulation
+type SimulatedTask struct {
+	Name     string
+	Duration Distribution
+}
+
+// Simulation is the Runner configuration played by Simulate
+type Simulation struct {
+	Interval              time.Duration
+	ShouldRunOnGoroutines bool
+	TickBudget            time.Duration
+	// MaxConcurrency is the cap set with Runner.SetMaxConcurrency
+	MaxConcurrency int
+	// Workers is the pool size set with Runner.SetWorkers, in goroutine
+	// mode the executions wait for a free worker, a task waits with one
+	// execution at most. zero doesn't limit them
+	Workers int
+	Tasks   []SimulatedTask
+	// Length is how much virtual time to play, like 24h or a week
+	Length time.Duration
+	// Seed makes the sampled durations reproducible
+	Seed int64
+}
+
+// TaskSimulation is the result of a simulation for a single task
+type TaskSimulation struct {
+	Executions int
+	// Delay is how long the executions waited after their tick, for the
+	// synchronous loop or for a worker
+	MeanDelay, MaxDelay time.Duration
+	// Overlaps counts executions that started while the previous one of
+	// the same task was still running
+	Overlaps int
+	// Skipped counts executions skipped by the concurrency cap or while
+	// the previous one waited for a worker
+	Skipped int
+}
+
+// SimulationReport is the result of Simulate
+type SimulationReport struct {
+	Ticks int
+	// DroppedTicks counts ticks lost because the Runner was still busy
+	// with a previous tick, like time.Ticker drops them
+	DroppedTicks int
+	// Deferred counts tasks deferred to the next tick by the tick budget
+	Deferred   int
+	Executions int
+	// Skipped counts executions skipped by the concurrency cap or while
+	// the previous one waited for a worker
+	Skipped   int
+	MeanDelay time.Duration
+	MaxDelay  time.Duration
+	// Utilization is the total execution time over Length, it's the
+	// average number of busy goroutines, so at most 1 in synchronous mode
+	Utilization    float64
+	MaxConcurrency int
+	Overlaps       int
+	Tasks          map[string]TaskSimulation
+}
+
+// Simulate plays a Runner configuration in virtual time with the task
+// durations drawn from their distributions, nothing is actually run.
+// NOTE: it's a model of the Runner loop, not the Runner itself: it plays
+//
+//	the ticks (dropped like time.Ticker drops them), the synchronous loop
+//	with its tick budget and the goroutine mode with its concurrency cap
+//	and its workers. retries, guards, misfires, offsets, pauses and the
+//	time spent by the Runner itself aren't simulated
+func Simulate(s Simulation) SimulationReport {
+	sim := simulator{
+		Simulation: s,
+		rng:        rand.New(rand.NewSource(s.Seed)),
+		lastEnd:    make([]time.Duration, len(s.Tasks)),
+		lastStart:  make([]time.Duration, len(s.Tasks)),
+		tasks:      make([]TaskSimulation, len(s.Tasks)),
+		delays:     make([]time.Duration, len(s.Tasks)),
+	}
+	if s.ShouldRunOnGoroutines {
+		// every worker is free from the start
+		sim.pool = make(endHeap, s.Workers)
+	}
+	if s.Interval > 0 && len(s.Tasks) > 0 {
+		sim.play()
+	}
+	return sim.report()
+}
+
+type simulator struct {
+	Simulation
+	rng *rand.Rand
+
+	result     SimulationReport
+	busy       time.Duration // total execution time
+	delay      time.Duration // total delay
+	running    endHeap       // end times of the running executions
+	inFlight   endHeap       // end times of the executions started or waiting for a worker
+	pool       endHeap       // when each worker is free again
+	lastEnd    []time.Duration
+	lastStart  []time.Duration // start of the last execution dispatched
+	tasks      []TaskSimulation
+	delays     []time.Duration
+	workerFree time.Duration // when the synchronous loop is free again
+	cursor     int
+}
+
+func (sim *simulator) play() {
+	for tick := sim.Interval; tick <= sim.Length; {
+		sim.result.Ticks++
+		if sim.ShouldRunOnGoroutines {
+			for i := range sim.Tasks {
+				// a task waits for a worker with one execution at most, and
+				// like Runner.inFlightCount the cap counts the waiting ones
+				if sim.lastStart[i] > tick || sim.MaxConcurrency > 0 && sim.inFlight.at(tick) >= sim.MaxConcurrency {
+					sim.result.Skipped++
+					sim.tasks[i].Skipped++
+					continue
+				}
+				heap.Push(&sim.inFlight, sim.dispatch(i, tick))
+			}
+			tick += sim.Interval
+			continue
+		}
+
+		start := tick
+		if sim.workerFree > start {
+			start = sim.workerFree
+		}
+		sim.workerFree = sim.runTick(tick, start)
+		// the tick waited in the ticker's buffer until start, the ticks
+		// that came meanwhile (within Length) were dropped
+		next := (start/sim.Interval + 1) * sim.Interval
+		last := next - sim.Interval
+		if last > sim.Length {
+			last = sim.Length
+		}
+		sim.result.DroppedTicks += int((last - tick) / sim.Interval)
+		tick = next
+	}
+}
+
+// runTick runs the tasks one after the other like the synchronous loop,
+// it returns when the tick is done
+func (sim *simulator) runTick(tick, start time.Duration) time.Duration {
+	n := len(sim.Tasks)
+	now := start
+	for i := 0; i < n; i++ {
+		if sim.TickBudget > 0 && i > 0 && now-start >= sim.TickBudget {
+			sim.result.Deferred += n - i
+			sim.cursor = (sim.cursor + i) % n
+			return now
+		}
+		now = sim.execute((sim.cursor+i)%n, tick, now)
+	}
+	return now
+}
+
+// dispatch plays one execution of task i in goroutine mode, it starts once
+// a worker is free and dispatch returns when it ends
+func (sim *simulator) dispatch(i int, tick time.Duration) time.Duration {
+	if len(sim.pool) == 0 {
+		return sim.execute(i, tick, tick)
+	}
+	// the workers are taken in the order they're freed and the ticks come
+	// in order, so the executions start in order too
+	start := heap.Pop(&sim.pool).(time.Duration)
+	if start < tick {
+		start = tick
+	}
+	sim.lastStart[i] = start
+	end := sim.execute(i, tick, start)
+	heap.Push(&sim.pool, end)
+	return end
+}
+
+// execute plays one execution of task i and returns when it ends
+func (sim *simulator) execute(i int, tick, start time.Duration) time.Duration {
+	d := sim.Tasks[i].Duration.Sample(sim.rng)
+	end := start + d
+	delay := start - tick
+
+	sim.result.Executions++
+	sim.busy += d
+	sim.delay += delay
+	if delay > sim.result.MaxDelay {
+		sim.result.MaxDelay = delay
+	}
+	task := &sim.tasks[i]
+	task.Executions++
+	sim.delays[i] += delay
+	if delay > task.MaxDelay {
+		task.MaxDelay = delay
+	}
+	if sim.lastEnd[i] > start {
+		task.Overlaps++
+		sim.result.Overlaps++
+	}
+	if end > sim.lastEnd[i] {
+		sim.lastEnd[i] = end
+	}
+
+	sim.running.at(start)
+	heap.Push(&sim.running, end)
+	if len(sim.running) > sim.result.MaxConcurrency {
+		sim.result.MaxConcurrency = len(sim.running)
+	}
+	return end
+}
+
+func (sim *simulator) report() SimulationReport {
+	report := sim.result
+	report.Tasks = map[string]TaskSimulation{}
+	if report.Executions > 0 {
+		report.MeanDelay = sim.delay / time.Duration(report.Executions)
+	}
+	if sim.Length > 0 {
+		report.Utilization = float64(sim.busy) / float64(sim.Length)
+	}
+	for i, task := range sim.tasks {
+		if task.Executions > 0 {
+			task.MeanDelay = sim.delays[i] / time.Duration(task.Executions)
+		}
+		report.Tasks[sim.Tasks[i].Name] = task
+	}
+	return report
+}
+
+// endHeap is a min-heap of execution end times
+type endHeap []time.Duration
+
+// at drops the end times up to t and returns how many are left
+func (h *endHeap) at(t time.Duration) int {
+	for len(*h) > 0 && (*h)[0] <= t {
+		heap.Pop(h)
+	}
+	return len(*h)
+}
+
+func (h endHeap) Len() int            { return len(h) }
+func (h endHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h endHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *endHeap) Push(x interface{}) { *h = append(*h, x.(time.Duration)) }
+func (h *endHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
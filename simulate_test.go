@@ -0,0 +1,116 @@
+package llamatask
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulateGoroutines(t *testing.T) {
+	report := Simulate(Simulation{
+		Interval:              time.Minute,
+		ShouldRunOnGoroutines: true,
+		Tasks:                 []SimulatedTask{{Name: "export", Duration: Fixed(90 * time.Second)}},
+		Length:                10 * time.Minute,
+	})
+	if report.Ticks != 10 || report.Executions != 10 || report.DroppedTicks != 0 {
+		t.Errorf("ticks %d, executions %d, dropped %d; want 10, 10, 0", report.Ticks, report.Executions, report.DroppedTicks)
+	}
+	if report.Overlaps != 9 || report.MaxConcurrency != 2 || report.MaxDelay != 0 {
+		t.Errorf("overlaps %d, concurrency %d, max delay %s; want 9, 2, 0", report.Overlaps, report.MaxConcurrency, report.MaxDelay)
+	}
+	if report.Utilization != 1.5 {
+		t.Errorf("utilization %v, want 1.5", report.Utilization)
+	}
+}
+
+func TestSimulateSynchronous(t *testing.T) {
+	report := Simulate(Simulation{
+		Interval: time.Minute,
+		Tasks:    []SimulatedTask{{Name: "export", Duration: Fixed(150 * time.Second)}},
+		Length:   10 * time.Minute,
+	})
+	// the executions start at 1, 3.5, 6, 8.5 and 11 minutes
+	if report.Ticks != 5 || report.DroppedTicks != 5 || report.Executions != 5 {
+		t.Errorf("ticks %d, dropped %d, executions %d; want 5, 5, 5", report.Ticks, report.DroppedTicks, report.Executions)
+	}
+	if report.MaxDelay != 2*time.Minute || report.MeanDelay != 84*time.Second {
+		t.Errorf("max delay %s, mean delay %s; want 2m, 1m24s", report.MaxDelay, report.MeanDelay)
+	}
+	if report.Overlaps != 0 || report.MaxConcurrency != 1 {
+		t.Errorf("overlaps %d, concurrency %d in synchronous mode", report.Overlaps, report.MaxConcurrency)
+	}
+}
+
+func TestSimulateTickBudget(t *testing.T) {
+	report := Simulate(Simulation{
+		Interval:   time.Minute,
+		TickBudget: 20 * time.Second,
+		Tasks: []SimulatedTask{
+			{Name: "a", Duration: Fixed(30 * time.Second)},
+			{Name: "b", Duration: Fixed(30 * time.Second)},
+		},
+		Length: 4 * time.Minute,
+	})
+	// a single task fits in each tick, they take turns
+	if report.Deferred != 4 || report.Tasks["a"].Executions != 2 || report.Tasks["b"].Executions != 2 {
+		t.Errorf("deferred %d, a %d, b %d; want 4, 2, 2", report.Deferred, report.Tasks["a"].Executions, report.Tasks["b"].Executions)
+	}
+}
+
+func TestSimulateMaxConcurrency(t *testing.T) {
+	report := Simulate(Simulation{
+		Interval:              time.Minute,
+		ShouldRunOnGoroutines: true,
+		MaxConcurrency:        2,
+		Tasks:                 []SimulatedTask{{Name: "export", Duration: Fixed(150 * time.Second)}},
+		Length:                10 * time.Minute,
+	})
+	if report.Executions != 7 || report.Skipped != 3 || report.Tasks["export"].Skipped != 3 {
+		t.Errorf("executions %d, skipped %d; want 7, 3", report.Executions, report.Skipped)
+	}
+	if report.MaxConcurrency != 2 {
+		t.Errorf("concurrency %d over the cap", report.MaxConcurrency)
+	}
+}
+
+func TestSimulateWorkers(t *testing.T) {
+	report := Simulate(Simulation{
+		Interval:              time.Minute,
+		ShouldRunOnGoroutines: true,
+		Workers:               1,
+		Tasks:                 []SimulatedTask{{Name: "export", Duration: Fixed(90 * time.Second)}},
+		Length:                10 * time.Minute,
+	})
+	// the executions wait up to 90s for the worker, the ones of the ticks
+	// at 5 and 8 minutes are skipped while the previous one still waits
+	if report.Executions != 8 || report.Skipped != 2 || report.MaxDelay != 90*time.Second || report.MeanDelay != time.Minute {
+		t.Errorf("executions %d, skipped %d, max delay %s, mean delay %s; want 8, 2, 1m30s, 1m", report.Executions, report.Skipped, report.MaxDelay, report.MeanDelay)
+	}
+	if report.Overlaps != 0 || report.MaxConcurrency != 1 {
+		t.Errorf("overlaps %d, concurrency %d with a single worker", report.Overlaps, report.MaxConcurrency)
+	}
+
+	report = Simulate(Simulation{
+		Interval:              time.Minute,
+		ShouldRunOnGoroutines: true,
+		Workers:               2,
+		Tasks:                 []SimulatedTask{{Name: "export", Duration: Fixed(90 * time.Second)}},
+		Length:                10 * time.Minute,
+	})
+	if report.MaxDelay != 0 || report.MaxConcurrency != 2 {
+		t.Errorf("max delay %s, concurrency %d; want no wait with enough workers", report.MaxDelay, report.MaxConcurrency)
+	}
+}
+
+func TestSimulateSeed(t *testing.T) {
+	s := Simulation{
+		Interval:              time.Minute,
+		ShouldRunOnGoroutines: true,
+		Tasks:                 []SimulatedTask{{Name: "a", Duration: Normal{Mean: time.Minute, StdDev: 30 * time.Second}}},
+		Length:                24 * time.Hour,
+		Seed:                  42,
+	}
+	if a, b := Simulate(s), Simulate(s); a.Utilization != b.Utilization || a.Overlaps != b.Overlaps {
+		t.Errorf("the same seed gave different reports")
+	}
+}
@@ -0,0 +1,225 @@
+package llamatask
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// SolarEvent is the solar event a SolarSchedule follows
+type SolarEvent int
+
+const (
+	Sunrise SolarEvent = iota
+	Sunset
+)
+
+// Twilight selects how far below the horizon the sun has to be for the
+// event, the default is the official sunrise/sunset
+type Twilight int
+
+const (
+	TwilightOfficial Twilight = iota
+	TwilightCivil
+	TwilightNautical
+	TwilightAstronomical
+)
+
+// zenith returns the zenith angle of the sun (in degrees) for the twilight
+func (t Twilight) zenith() float64 {
+	switch t {
+	case TwilightCivil:
+		return 96
+	case TwilightNautical:
+		return 102
+	case TwilightAstronomical:
+		return 108
+	}
+	return 90.833 // accounts for refraction and the radius of the sun
+}
+
+// SolarSchedule describes a time relative to the sunrise or sunset at a
+// location, it's computed offline from the solar position
+type SolarSchedule struct {
+	Latitude  float64 // degrees, north is positive
+	Longitude float64 // degrees, east is positive
+	Event     SolarEvent
+	Twilight  Twilight
+	Offset    time.Duration // added to the event time, may be negative
+	// Location is the time zone used to decide which calendar day an event
+	// belongs to, defaults to time.Local
+	Location *time.Location
+}
+
+// On returns the time of the event on the calendar day of date.
+// ok is false if the event doesn't happen that day (polar day or night)
+func (s SolarSchedule) On(date time.Time) (t time.Time, ok bool) {
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	date = date.In(loc)
+	year, month, day := date.Date()
+	hours, ok := solarEventUTC(date.YearDay(), s.Latitude, s.Longitude, s.Event, s.Twilight.zenith())
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).
+		Add(time.Duration(hours * float64(time.Hour))).In(loc)
+	// the UTC hour may belong to the previous or next local day. the event
+	// moves by a few minutes from a day to the next, so shifting it by 24h
+	// is close enough and, unlike AddDate, it's right across DST changes
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if t.Before(midnight) {
+		t = t.Add(24 * time.Hour)
+	} else if !t.Before(midnight.AddDate(0, 0, 1)) {
+		t = t.Add(-24 * time.Hour)
+	}
+	return t.Add(s.Offset), true
+}
+
+// Next returns the first event strictly after the given time.
+// ok is false if there is no event in the following year
+func (s SolarSchedule) Next(after time.Time) (time.Time, bool) {
+	for i := -1; i <= 366; i++ {
+		t, ok := s.On(after.AddDate(0, 0, i))
+		if ok && t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// solarEventUTC returns the hour (UTC) of the event on the given day of the
+// year, based on the sunrise/sunset algorithm of the Almanac for Computers
+func solarEventUTC(yearDay int, lat, lng float64, event SolarEvent, zenith float64) (float64, bool) {
+	const rad = math.Pi / 180
+	lngHour := lng / 15
+
+	t := float64(yearDay) + (6-lngHour)/24
+	if event == Sunset {
+		t = float64(yearDay) + (18-lngHour)/24
+	}
+
+	// sun's mean anomaly and true longitude
+	m := 0.9856*t - 3.289
+	l := normalizeDegrees(m + 1.916*math.Sin(m*rad) + 0.020*math.Sin(2*m*rad) + 282.634)
+
+	// right ascension, in the same quadrant as l
+	ra := normalizeDegrees(math.Atan(0.91764*math.Tan(l*rad)) / rad)
+	ra += math.Floor(l/90)*90 - math.Floor(ra/90)*90
+	ra /= 15
+
+	// declination and local hour angle
+	sinDec := 0.39782 * math.Sin(l*rad)
+	cosDec := math.Cos(math.Asin(sinDec))
+	cosH := (math.Cos(zenith*rad) - sinDec*math.Sin(lat*rad)) / (cosDec * math.Cos(lat*rad))
+	if cosH > 1 || cosH < -1 {
+		return 0, false
+	}
+	h := math.Acos(cosH) / rad
+	if event == Sunrise {
+		h = 360 - h
+	}
+	h /= 15
+
+	localMean := h + ra - 0.06571*t - 6.622
+	return math.Mod(math.Mod(localMean-lngHour, 24)+24, 24), true
+}
+
+func normalizeDegrees(d float64) float64 {
+	return math.Mod(math.Mod(d, 360)+360, 360)
+}
+
+// SolarTask runs a task once per day at the time given by a SolarSchedule.
+// the schedule is checked on each tick of the Runner, so the task runs on
+// the first tick after the event
+type SolarTask struct {
+	Schedule SolarSchedule
+	task     interface{}
+
+	mut  sync.Mutex
+	next time.Time
+}
+
+// NewSolarTask creates a SolarTask that runs the Task or FallibleTask t
+// according to s
+func NewSolarTask(s SolarSchedule, t interface{}) *SolarTask {
+	return &SolarTask{Schedule: s, task: t}
+}
+
+// Name returns the name of the wrapped task
+func (s *SolarTask) Name() string {
+	return taskName(s.task)
+}
+
+// UseState gives the State to the wrapped task if it's a StatefulTask
+func (s *SolarTask) UseState(state *State) {
+	if t, ok := s.task.(stateUser); ok {
+		t.UseState(state)
+	}
+}
+
+// Guards returns the guards of the wrapped task
+func (s *SolarTask) Guards() []Guard {
+	if t, ok := s.task.(guarder); ok {
+		return t.Guards()
+	}
+	return nil
+}
+
+// Initialize initializes the wrapped task if it has an initializer
+func (s *SolarTask) Initialize() {
+	if t, ok := s.task.(initializer); ok {
+		t.Initialize()
+	}
+}
+
+// Teardown tears down the wrapped task if it has a teardown
+func (s *SolarTask) Teardown() {
+	if t, ok := s.task.(teardowner); ok {
+		t.Teardown()
+	}
+}
+
+// Run runs the wrapped task if the scheduled event has passed
+func (s *SolarTask) Run() error {
+	return s.runWrapped(context.Background(), time.Now())
+}
+
+// runWrapped runs the wrapped task for the tick at scheduled if the event
+// has passed, the Runner calls it instead of Run
+func (s *SolarTask) runWrapped(ctx context.Context, scheduled time.Time) error {
+	now := time.Now()
+	s.mut.Lock()
+	if s.next.IsZero() {
+		s.next, _ = s.Schedule.Next(now)
+		s.mut.Unlock()
+		return nil
+	}
+	if now.Before(s.next) {
+		s.mut.Unlock()
+		return nil
+	}
+	// move to the next event before running, so an overlapping tick in
+	// goroutine mode doesn't run the task for the same event again
+	s.next, _ = s.Schedule.Next(now)
+	s.mut.Unlock()
+	return runTask(ctx, s.task, scheduled)
+}
+
+// Next returns when the wrapped task will run next
+func (s *SolarTask) Next() time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.next
+}
+
+// Reschedule drops the event missed during a clock jump
+func (s *SolarTask) Reschedule(now time.Time) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.next, _ = s.Schedule.Next(now)
+}
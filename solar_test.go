@@ -0,0 +1,159 @@
+package llamatask
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// the expected times come from the NOAA solar calculator
+func TestSolarScheduleOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		zone     string
+		date     string
+		event    SolarEvent
+		twilight Twilight
+		want     string // local HH:MM
+	}{
+		{"Los Angeles DST start sunrise", 34.0522, -118.2437, "America/Los_Angeles", "2024-03-10", Sunrise, TwilightOfficial, "07:09"},
+		{"Los Angeles DST start sunset", 34.0522, -118.2437, "America/Los_Angeles", "2024-03-10", Sunset, TwilightOfficial, "18:57"},
+		{"Los Angeles DST end sunrise", 34.0522, -118.2437, "America/Los_Angeles", "2024-11-03", Sunrise, TwilightOfficial, "06:14"},
+		{"Los Angeles DST end sunset", 34.0522, -118.2437, "America/Los_Angeles", "2024-11-03", Sunset, TwilightOfficial, "16:57"},
+		{"London solstice sunrise", 51.5074, -0.1278, "Europe/London", "2024-06-21", Sunrise, TwilightOfficial, "04:43"},
+		{"London solstice sunset", 51.5074, -0.1278, "Europe/London", "2024-06-21", Sunset, TwilightOfficial, "21:21"},
+		{"London civil dawn", 51.5074, -0.1278, "Europe/London", "2024-06-21", Sunrise, TwilightCivil, "03:55"},
+		{"New York winter sunrise", 40.7128, -74.0060, "America/New_York", "2024-12-21", Sunrise, TwilightOfficial, "07:16"},
+		{"New York winter sunset", 40.7128, -74.0060, "America/New_York", "2024-12-21", Sunset, TwilightOfficial, "16:32"},
+		{"Sydney summer sunrise", -33.8688, 151.2093, "Australia/Sydney", "2024-12-21", Sunrise, TwilightOfficial, "05:40"},
+		{"Sydney summer sunset", -33.8688, 151.2093, "Australia/Sydney", "2024-12-21", Sunset, TwilightOfficial, "20:05"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loc := mustLoadLocation(t, test.zone)
+			date, _ := time.ParseInLocation("2006-01-02", test.date, loc)
+			want, _ := time.ParseInLocation("2006-01-02 15:04", test.date+" "+test.want, loc)
+			s := SolarSchedule{Latitude: test.lat, Longitude: test.lng, Event: test.event, Twilight: test.twilight, Location: loc}
+			got, ok := s.On(date)
+			if !ok {
+				t.Fatal("no event")
+			}
+			if diff := got.Sub(want); diff.Abs() > 2*time.Minute {
+				t.Errorf("On(%s) = %s, want %s", test.date, got.Format("2006-01-02 15:04 MST"), want.Format("2006-01-02 15:04 MST"))
+			}
+		})
+	}
+}
+
+func TestSolarScheduleOffset(t *testing.T) {
+	loc := mustLoadLocation(t, "Europe/London")
+	date := time.Date(2024, 6, 21, 0, 0, 0, 0, loc)
+	s := SolarSchedule{Latitude: 51.5074, Longitude: -0.1278, Event: Sunset, Location: loc}
+	event, _ := s.On(date)
+	s.Offset = -30 * time.Minute
+	if got, _ := s.On(date); got != event.Add(-30*time.Minute) {
+		t.Errorf("On with offset = %s, want %s", got, event.Add(-30*time.Minute))
+	}
+}
+
+func TestSolarSchedulePolar(t *testing.T) {
+	loc := mustLoadLocation(t, "Europe/Oslo")
+	tromso := SolarSchedule{Latitude: 69.6492, Longitude: 18.9553, Location: loc}
+
+	tromso.Event = Sunset
+	if got, ok := tromso.On(time.Date(2024, 6, 21, 12, 0, 0, 0, loc)); ok {
+		t.Errorf("sunset during the midnight sun = %s, want none", got)
+	}
+	tromso.Event = Sunrise
+	if got, ok := tromso.On(time.Date(2024, 12, 21, 12, 0, 0, 0, loc)); ok {
+		t.Errorf("sunrise during the polar night = %s, want none", got)
+	}
+
+	// the polar night ends mid-January
+	next, ok := tromso.Next(time.Date(2024, 12, 1, 0, 0, 0, 0, loc))
+	if !ok {
+		t.Fatal("no sunrise after the polar night")
+	}
+	if next.Year() != 2025 || next.Month() != time.January {
+		t.Errorf("first sunrise after the polar night = %s, want January 2025", next)
+	}
+
+	// the midnight sun of Longyearbyen lasts from April to August
+	longyearbyen := SolarSchedule{Latitude: 78.2232, Longitude: 15.6267, Event: Sunset, Location: loc}
+	next, ok = longyearbyen.Next(time.Date(2024, 5, 1, 0, 0, 0, 0, loc))
+	if !ok || next.Month() != time.August {
+		t.Errorf("first sunset after the midnight sun = %s, %v, want August", next, ok)
+	}
+}
+
+func TestSolarScheduleNext(t *testing.T) {
+	loc := mustLoadLocation(t, "America/Los_Angeles")
+	s := SolarSchedule{Latitude: 34.0522, Longitude: -118.2437, Event: Sunset, Location: loc}
+	sunset, _ := s.On(time.Date(2024, 3, 10, 0, 0, 0, 0, loc))
+	if got, _ := s.Next(sunset.Add(-time.Minute)); got != sunset {
+		t.Errorf("Next before the sunset = %s, want %s", got, sunset)
+	}
+	got, _ := s.Next(sunset)
+	if y, m, d := got.Date(); y != 2024 || m != time.March || d != 11 {
+		t.Errorf("Next at the sunset = %s, want the next day", got)
+	}
+}
+
+func TestSolarTaskRunsOncePerEvent(t *testing.T) {
+	task := &countTask{}
+	s := NewSolarTask(SolarSchedule{Latitude: 51.5074, Longitude: -0.1278, Location: time.UTC}, task)
+	s.next = time.Now().Add(-time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run()
+		}()
+	}
+	wg.Wait()
+	if got := task.count(); got != 1 {
+		t.Errorf("task ran %d times for a single event, want 1", got)
+	}
+	if !s.Next().After(time.Now()) {
+		t.Errorf("next run %s isn't in the future", s.Next())
+	}
+}
+
+func TestSolarTaskForwards(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	task := &customerTask{}
+	s := NewSolarTask(SolarSchedule{Latitude: 51.5074, Longitude: -0.1278, Location: time.UTC}, task)
+	h := r.AddTask(s)
+	if h.Name() != taskName(task) {
+		t.Errorf("got name %q, want the name of the wrapped task", h.Name())
+	}
+	if err := r.RemoveTask(h); err != nil {
+		t.Fatal(err)
+	}
+	if task.teardown != 1 {
+		t.Error("the wrapped task wasn't torn down")
+	}
+
+	errFailed := errors.New("failed")
+	s = NewSolarTask(SolarSchedule{Latitude: 51.5074, Longitude: -0.1278, Location: time.UTC}, failingTask{errFailed})
+	r.AddTask(s)
+	s.next = time.Now().Add(-time.Minute)
+	r.tick(time.Now())
+	if e := r.History()[0]; e.Outcome != OutcomeFailed || !errors.Is(e.Err, errFailed) {
+		t.Errorf("got %s execution with %v, want the error of the wrapped task", e.Outcome, e.Err)
+	}
+}
@@ -0,0 +1,157 @@
+package llamatask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDuplicateTask is returned when adding a NamedTask under a name that is
+// already used in the Runner
+var ErrDuplicateTask = errors.New("llamatask: a task with this name is already registered")
+
+// ErrUnnamedState is returned when adding a StatefulTask that isn't a
+// NamedTask, its state wouldn't have a stable key
+var ErrUnnamedState = errors.New("llamatask: a StatefulTask must be a NamedTask")
+
+// JobStore persists the data of a Runner's tasks, like their State
+type JobStore interface {
+	// Get returns the value of key, ok is false if it's not set
+	Get(key string) (value []byte, ok bool, err error)
+	Set(key string, value []byte) error
+	// CompareAndSet sets key to new only if its current value is old, a nil
+	// old means the key must not be set. it reports whether key was set
+	CompareAndSet(key string, old, new []byte) (bool, error)
+	Delete(key string) error
+}
+
+// MemoryStore is a JobStore that keeps everything in memory, it's the
+// default store of a Runner
+type MemoryStore struct {
+	mut  sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemoryStore initializes a new MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string][]byte{}}
+}
+
+// Get returns the value of key
+func (m *MemoryStore) Get(key string) ([]byte, bool, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	value, ok := m.data[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return clone(value), true, nil
+}
+
+// Set sets the value of key
+func (m *MemoryStore) Set(key string, value []byte) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.data[key] = clone(value)
+	return nil
+}
+
+// CompareAndSet sets key to new if its current value is old
+func (m *MemoryStore) CompareAndSet(key string, old, new []byte) (bool, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	current, ok := m.data[key]
+	if old == nil && ok || old != nil && (!ok || !bytes.Equal(current, old)) {
+		return false, nil
+	}
+	m.data[key] = clone(new)
+	return true, nil
+}
+
+// Delete removes key
+func (m *MemoryStore) Delete(key string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.data, key)
+	return nil
+}
+
+// clone copies b, keeping empty values distinct from nil
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
+// NamedTask is a Task with a stable name, the name is used to key its state
+// and its crash count, and in events. it must be unique in the Runner.
+// tasks without a name are named after their type
+type NamedTask interface {
+	Task
+	Name() string
+}
+
+// StatefulTask is a Task that keeps a State between runs. UseState is
+// called before Initialize when the task is added to a Runner.
+// it must be a NamedTask too
+type StatefulTask interface {
+	Task
+	UseState(*State)
+}
+
+// State is the key-value state of a task, backed by the JobStore of the Runner
+type State struct {
+	store  JobStore
+	prefix string
+}
+
+// Get returns the value of key
+func (s *State) Get(key string) ([]byte, bool, error) {
+	return s.store.Get(s.prefix + key)
+}
+
+// Set sets the value of key
+func (s *State) Set(key string, value []byte) error {
+	return s.store.Set(s.prefix+key, value)
+}
+
+// CompareAndSet sets key to new if its current value is old (nil if unset)
+func (s *State) CompareAndSet(key string, old, new []byte) (bool, error) {
+	return s.store.CompareAndSet(s.prefix+key, old, new)
+}
+
+// Delete removes key
+func (s *State) Delete(key string) error {
+	return s.store.Delete(s.prefix + key)
+}
+
+// SetJobStore sets the store used for the state of the tasks added after it
+func (r *Runner) SetJobStore(store JobStore) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.store = store
+}
+
+// attachState gives t its State if it's a StatefulTask, keyed by name or
+// by the name of t if name is empty
+func (r *Runner) attachState(t interface{}, name string) error {
+	statefulTask, ok := t.(stateUser)
+	if !ok {
+		return nil
+	}
+	if namedTask, ok := t.(namer); ok && name == "" {
+		name = namedTask.Name()
+	}
+	if name == "" {
+		return fmt.Errorf("%w: %T", ErrUnnamedState, t)
+	}
+	r.mut.Lock()
+	store := r.store
+	r.mut.Unlock()
+	statefulTask.UseState(taskState(store, name))
+	return nil
+}
+
+// taskState returns the State of the task with the given name
+func taskState(store JobStore, name string) *State {
+	return &State{store: store, prefix: "task/" + name + "/"}
+}
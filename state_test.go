@@ -0,0 +1,87 @@
+package llamatask
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// cursorTask remembers how many times it ran in its state
+type cursorTask struct {
+	name  string
+	state *State
+}
+
+func (t *cursorTask) Name() string        { return t.name }
+func (t *cursorTask) UseState(s *State)   { t.state = s }
+func (t *cursorTask) Run()                {}
+func (t *cursorTask) set(v string) error  { return t.state.Set("cursor", []byte(v)) }
+func (t *cursorTask) get() (string, bool) { v, ok, _ := t.state.Get("cursor"); return string(v), ok }
+
+type unnamedStatefulTask struct{}
+
+func (unnamedStatefulTask) Run()            {}
+func (unnamedStatefulTask) UseState(*State) {}
+
+func TestStateIsPerTask(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	a, b := &cursorTask{name: "a"}, &cursorTask{name: "b"}
+	if _, err := r.AddTasks(a, b); err != nil {
+		t.Fatal(err)
+	}
+	a.set("1")
+	if _, ok := b.get(); ok {
+		t.Errorf("b sees the state of a")
+	}
+	if ok, _ := a.state.CompareAndSet("cursor", []byte("1"), []byte("2")); !ok {
+		t.Errorf("CompareAndSet with the current value failed")
+	}
+	if v, _ := a.get(); v != "2" {
+		t.Errorf("cursor = %q, want 2", v)
+	}
+}
+
+func TestStateSurvivesReregistration(t *testing.T) {
+	store := NewMemoryStore()
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetJobStore(store)
+	first := &cursorTask{name: "sync"}
+	r.AddTask(first)
+	first.set("42")
+
+	r2, _ := newTestRunner(time.Minute, false)
+	r2.SetJobStore(store)
+	second := &cursorTask{name: "sync"}
+	r2.AddTask(second)
+	if v, _ := second.get(); v != "42" {
+		t.Errorf("cursor after a restart = %q, want 42", v)
+	}
+}
+
+func TestTaskNames(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	handles, err := r.AddTasks(&countTask{}, &countTask{}, &cursorTask{name: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles = append(handles, r.AddTask(&countTask{}))
+	want := []string{"*llamatask.countTask", "*llamatask.countTask#2", "a", "*llamatask.countTask#3"}
+	for i, h := range handles {
+		if h.Name() != want[i] {
+			t.Errorf("task %d is named %q, want %q", i, h.Name(), want[i])
+		}
+	}
+
+	if _, err := r.AddTasks(&cursorTask{name: "a"}); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("adding a duplicate name: got %v, want ErrDuplicateTask", err)
+	}
+	if _, err := r.AddTasks(&cursorTask{name: "b"}, &cursorTask{name: "b"}); !errors.Is(err, ErrDuplicateTask) {
+		t.Errorf("adding a duplicate name in a batch: got %v, want ErrDuplicateTask", err)
+	}
+	if _, err := r.AddTasks(unnamedStatefulTask{}); !errors.Is(err, ErrUnnamedState) {
+		t.Errorf("adding an unnamed stateful task: got %v, want ErrUnnamedState", err)
+	}
+	if got := len(r.Tasks()); got != 4 {
+		t.Errorf("%d tasks registered, want 4", got)
+	}
+}
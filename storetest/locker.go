@@ -0,0 +1,101 @@
+package storetest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LlamaNite/llamatask"
+)
+
+// leaseTTL is the lease used by TestLocker, the expiry checks sleep for twice
+// as long
+const leaseTTL = 50 * time.Millisecond
+
+// TestLocker checks that the lockers created by newLocker behave like a
+// llamatask.Locker: exclusive leases, TTL expiry and recovery from an owner
+// that crashed. newLocker must return a locker with no key held on each call
+func TestLocker(t *testing.T, newLocker func(t *testing.T) llamatask.Locker) {
+	t.Run("Exclusive", func(t *testing.T) {
+		l := newLocker(t)
+		mustLock(t, l, "job", "a", time.Hour, true)
+		mustLock(t, l, "job", "b", time.Hour, false)
+		mustLock(t, l, "other", "b", time.Hour, true)
+		mustLock(t, l, "job", "a", time.Hour, true) // extends the lease
+		mustUnlock(t, l, "job", "b")                // not held by b
+		mustLock(t, l, "job", "b", time.Hour, false)
+		mustUnlock(t, l, "job", "a")
+		mustLock(t, l, "job", "b", time.Hour, true)
+		mustUnlock(t, l, "missing", "a")
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		l := newLocker(t)
+		mustLock(t, l, "job", "a", leaseTTL, true)
+		mustLock(t, l, "job", "b", leaseTTL, false)
+		time.Sleep(2 * leaseTTL)
+		mustLock(t, l, "job", "b", time.Hour, true)
+	})
+
+	t.Run("Extend", func(t *testing.T) {
+		l := newLocker(t)
+		mustLock(t, l, "job", "a", leaseTTL, true)
+		mustLock(t, l, "job", "a", time.Hour, true)
+		time.Sleep(2 * leaseTTL)
+		mustLock(t, l, "job", "b", time.Hour, false)
+	})
+
+	t.Run("CrashRecovery", func(t *testing.T) {
+		l := newLocker(t)
+		mustLock(t, l, "job", "a", leaseTTL, true)
+		// a crashes without unlocking, b takes over once the lease expired
+		time.Sleep(2 * leaseTTL)
+		mustLock(t, l, "job", "b", time.Hour, true)
+		// a late Unlock or Lock of a doesn't take the key back
+		mustUnlock(t, l, "job", "a")
+		mustLock(t, l, "job", "a", time.Hour, false)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		l := newLocker(t)
+		var won int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(owner string) {
+				defer wg.Done()
+				ok, err := l.Lock("job", owner, time.Hour)
+				if err != nil {
+					t.Errorf("Lock: %v", err)
+				}
+				if ok {
+					atomic.AddInt32(&won, 1)
+				}
+			}(fmt.Sprint("owner", i))
+		}
+		wg.Wait()
+		if won != 1 {
+			t.Errorf("%d owners hold the key, want 1", won)
+		}
+	})
+}
+
+func mustLock(t *testing.T, l llamatask.Locker, key, owner string, ttl time.Duration, want bool) {
+	t.Helper()
+	ok, err := l.Lock(key, owner, ttl)
+	if err != nil {
+		t.Fatalf("Lock(%q, %q): %v", key, owner, err)
+	}
+	if ok != want {
+		t.Fatalf("Lock(%q, %q) = %v; want %v", key, owner, ok, want)
+	}
+}
+
+func mustUnlock(t *testing.T, l llamatask.Locker, key, owner string) {
+	t.Helper()
+	if err := l.Unlock(key, owner); err != nil {
+		t.Fatalf("Unlock(%q, %q): %v", key, owner, err)
+	}
+}
@@ -0,0 +1,162 @@
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LlamaNite/llamatask"
+)
+
+// Queue is the part of a queue checked by TestQueue, *llamatask.Queue
+// implements it
+type Queue interface {
+	Enqueue(key string, t interface{}) error
+	Len() int
+	Pause()
+	Resume()
+	Close()
+}
+
+// TestQueue checks that the queues created by newQueue behave like a
+// llamatask.Queue: per-key FIFO order, parallel keys, pausing and closing.
+// newQueue must return an empty, running queue with the given number of
+// workers on each call
+func TestQueue(t *testing.T, newQueue func(t *testing.T, workers int) Queue) {
+	t.Run("PerKeyOrder", func(t *testing.T) {
+		q := newQueue(t, 4)
+		const keys, jobs = 3, 50
+		var mut sync.Mutex
+		order := map[string][]int{}
+		running := make([]int32, keys)
+		for j := 0; j < jobs; j++ {
+			for k := 0; k < keys; k++ {
+				k, j, key := k, j, fmt.Sprint("key", k)
+				mustEnqueue(t, q, key, job(func() {
+					if atomic.AddInt32(&running[k], 1) != 1 {
+						t.Errorf("two jobs of %s run at once", key)
+					}
+					time.Sleep(100 * time.Microsecond)
+					mut.Lock()
+					order[key] = append(order[key], j)
+					mut.Unlock()
+					atomic.AddInt32(&running[k], -1)
+				}))
+			}
+		}
+		q.Close()
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprint("key", k)
+			if len(order[key]) != jobs {
+				t.Fatalf("%s: %d jobs ran, want %d", key, len(order[key]), jobs)
+			}
+			for i, j := range order[key] {
+				if i != j {
+					t.Fatalf("%s: job %d ran at position %d", key, j, i)
+				}
+			}
+		}
+	})
+
+	t.Run("KeysRunInParallel", func(t *testing.T) {
+		q := newQueue(t, 2)
+		defer q.Close()
+		mustRunTogether(t, q, "a", "b")
+	})
+
+	t.Run("UnkeyedRunInParallel", func(t *testing.T) {
+		q := newQueue(t, 2)
+		defer q.Close()
+		mustRunTogether(t, q, "", "")
+	})
+
+	t.Run("PauseResume", func(t *testing.T) {
+		q := newQueue(t, 2)
+		defer q.Close()
+		q.Pause()
+		var runs int32
+		for i := 0; i < 5; i++ {
+			mustEnqueue(t, q, "", job(func() { atomic.AddInt32(&runs, 1) }))
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := atomic.LoadInt32(&runs); n != 0 {
+			t.Fatalf("%d jobs ran while paused", n)
+		}
+		if n := q.Len(); n != 5 {
+			t.Fatalf("Len = %d, want 5", n)
+		}
+		q.Resume()
+		waitUntil(t, "the jobs to run", func() bool { return atomic.LoadInt32(&runs) == 5 })
+		if n := q.Len(); n != 0 {
+			t.Errorf("Len = %d after the jobs ran", n)
+		}
+	})
+
+	t.Run("CloseRunsPending", func(t *testing.T) {
+		q := newQueue(t, 1)
+		q.Pause()
+		var runs int32
+		for i := 0; i < 5; i++ {
+			mustEnqueue(t, q, "key", job(func() { atomic.AddInt32(&runs, 1) }))
+		}
+		q.Close()
+		if n := atomic.LoadInt32(&runs); n != 5 {
+			t.Errorf("%d of the 5 pending jobs ran before Close returned", n)
+		}
+		if err := q.Enqueue("key", job(func() {})); !errors.Is(err, llamatask.ErrQueueClosed) {
+			t.Errorf("Enqueue after Close: got %v, want ErrQueueClosed", err)
+		}
+	})
+
+	t.Run("NotATask", func(t *testing.T) {
+		q := newQueue(t, 1)
+		defer q.Close()
+		if err := q.Enqueue("key", 42); !errors.Is(err, llamatask.ErrNotATask) {
+			t.Errorf("got %v, want ErrNotATask", err)
+		}
+	})
+}
+
+// job is a Task running f
+type job func()
+
+func (j job) Run() { j() }
+
+// mustRunTogether enqueues a job with each key, the first one only returns
+// once the second one ran
+func mustRunTogether(t *testing.T, q Queue, first, second string) {
+	t.Helper()
+	ran := make(chan struct{})
+	done := make(chan bool, 1)
+	mustEnqueue(t, q, first, job(func() {
+		select {
+		case <-ran:
+			done <- true
+		case <-time.After(5 * time.Second):
+			done <- false
+		}
+	}))
+	mustEnqueue(t, q, second, job(func() { close(ran) }))
+	if !<-done {
+		t.Errorf("the jobs of %q and %q didn't run in parallel", first, second)
+	}
+}
+
+func mustEnqueue(t *testing.T, q Queue, key string, j job) {
+	t.Helper()
+	if err := q.Enqueue(key, j); err != nil {
+		t.Fatalf("Enqueue(%q): %v", key, err)
+	}
+}
+
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package storetest implements conformance tests for llamatask.JobStore,
+// llamatask.Locker and queue implementations, like testing/fstest does for
+// file systems
+package storetest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/LlamaNite/llamatask"
+)
+
+// TestJobStore checks that the stores created by newStore behave like a
+// llamatask.JobStore. newStore must return an empty store on each call
+func TestJobStore(t *testing.T, newStore func(t *testing.T) llamatask.JobStore) {
+	t.Run("GetSetDelete", func(t *testing.T) {
+		s := newStore(t)
+		mustGet(t, s, "missing", nil, false)
+		mustSet(t, s, "key", []byte("value"))
+		mustGet(t, s, "key", []byte("value"), true)
+		mustSet(t, s, "key", []byte("other"))
+		mustGet(t, s, "key", []byte("other"), true)
+		if err := s.Delete("key"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		mustGet(t, s, "key", nil, false)
+		if err := s.Delete("key"); err != nil {
+			t.Fatalf("Delete of a missing key: %v", err)
+		}
+	})
+
+	t.Run("EmptyValue", func(t *testing.T) {
+		s := newStore(t)
+		mustSet(t, s, "key", []byte{})
+		mustGet(t, s, "key", []byte{}, true)
+	})
+
+	t.Run("CopiesValues", func(t *testing.T) {
+		s := newStore(t)
+		value := []byte("value")
+		mustSet(t, s, "key", value)
+		value[0] = 'X'
+		mustGet(t, s, "key", []byte("value"), true)
+		got, _, _ := s.Get("key")
+		got[0] = 'X'
+		mustGet(t, s, "key", []byte("value"), true)
+	})
+
+	t.Run("CompareAndSet", func(t *testing.T) {
+		s := newStore(t)
+		mustCAS(t, s, "key", []byte("a"), []byte("b"), false) // missing key
+		mustCAS(t, s, "key", nil, []byte("a"), true)
+		mustCAS(t, s, "key", nil, []byte("b"), false) // must be absent
+		mustCAS(t, s, "key", []byte("b"), []byte("c"), false)
+		mustCAS(t, s, "key", []byte("a"), []byte("c"), true)
+		mustGet(t, s, "key", []byte("c"), true)
+		mustSet(t, s, "empty", []byte{})
+		mustCAS(t, s, "empty", nil, []byte("x"), false) // empty isn't absent
+		mustCAS(t, s, "empty", []byte{}, []byte("x"), true)
+	})
+
+	t.Run("ConcurrentCompareAndSet", func(t *testing.T) {
+		s := newStore(t)
+		const workers, increments = 8, 50
+		mustSet(t, s, "counter", []byte("0"))
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for done := 0; done < increments; {
+					old, _, err := s.Get("counter")
+					if err != nil {
+						t.Errorf("Get: %v", err)
+						return
+					}
+					var n int
+					fmt.Sscan(string(old), &n)
+					ok, err := s.CompareAndSet("counter", old, []byte(fmt.Sprint(n+1)))
+					if err != nil {
+						t.Errorf("CompareAndSet: %v", err)
+						return
+					}
+					if ok {
+						done++
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		mustGet(t, s, "counter", []byte(fmt.Sprint(workers*increments)), true)
+	})
+
+	t.Run("ConcurrentKeys", func(t *testing.T) {
+		s := newStore(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprint("key", i)
+				for j := 0; j < 50; j++ {
+					if err := s.Set(key, []byte(fmt.Sprint(j))); err != nil {
+						t.Errorf("Set: %v", err)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		for i := 0; i < 8; i++ {
+			mustGet(t, s, fmt.Sprint("key", i), []byte("49"), true)
+		}
+	})
+}
+
+// TestJobStorePersistence checks that a durable store keeps its data when
+// it's reopened, like after a crash. open must return a store backed by the
+// same data on each call
+func TestJobStorePersistence(t *testing.T, open func(t *testing.T) llamatask.JobStore) {
+	s := open(t)
+	mustSet(t, s, "kept", []byte("value"))
+	mustSet(t, s, "deleted", []byte("value"))
+	if err := s.Delete("deleted"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	mustCAS(t, s, "swapped", nil, []byte("value"), true)
+
+	s = open(t)
+	mustGet(t, s, "kept", []byte("value"), true)
+	mustGet(t, s, "deleted", nil, false)
+	mustGet(t, s, "swapped", []byte("value"), true)
+}
+
+func mustGet(t *testing.T, s llamatask.JobStore, key string, want []byte, wantOK bool) {
+	t.Helper()
+	got, ok, err := s.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if ok != wantOK || ok && !bytes.Equal(got, want) {
+		t.Fatalf("Get(%q) = %q, %v; want %q, %v", key, got, ok, want, wantOK)
+	}
+}
+
+func mustSet(t *testing.T, s llamatask.JobStore, key string, value []byte) {
+	t.Helper()
+	if err := s.Set(key, value); err != nil {
+		t.Fatalf("Set(%q): %v", key, err)
+	}
+}
+
+func mustCAS(t *testing.T, s llamatask.JobStore, key string, old, new []byte, want bool) {
+	t.Helper()
+	ok, err := s.CompareAndSet(key, old, new)
+	if err != nil {
+		t.Fatalf("CompareAndSet(%q): %v", key, err)
+	}
+	if ok != want {
+		t.Fatalf("CompareAndSet(%q, %q, %q) = %v; want %v", key, old, new, ok, want)
+	}
+}
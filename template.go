@@ -0,0 +1,171 @@
+package llamatask
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrTemplateAdded is returned when adding a Template to a second Runner
+var ErrTemplateAdded = errors.New("llamatask: template is already added to a runner")
+
+// Params is one parameter set of a Template
+type Params struct {
+	// Suffix identifies the instance, it's appended to the template name
+	Suffix string
+	// Offset delays the instance after each tick, to spread the instances.
+	// in synchronous mode the other tasks and the Runner don't wait for it
+	Offset time.Duration
+	// Labels are the metrics labels of the instance, they're reported with
+	// its executions (see TaskHandle.Labels)
+	Labels map[string]string
+	Values map[string]string
+}
+
+// TemplateInstance is a task created by a Template for one parameter set
+type TemplateInstance struct {
+	ID     string
+	Params Params
+	task   Task
+	handle *TaskHandle
+}
+
+// Task returns the task created for the instance
+func (i *TemplateInstance) Task() Task {
+	return i.task
+}
+
+// Handle returns the handle of the instance, nil until the template is
+// added to a Runner
+func (i *TemplateInstance) Handle() *TaskHandle {
+	return i.handle
+}
+
+func (i *TemplateInstance) registration() registration {
+	return registration{task: i.task, name: i.ID, offset: i.Params.Offset, labels: i.Params.Labels}
+}
+
+// Template instantiates a task per parameter set with its factory. once
+// added to a Runner each instance is a task of its own, named after its ID
+type Template struct {
+	name    string
+	factory func(Params) Task
+
+	mut       sync.Mutex
+	runner    *Runner
+	instances []*TemplateInstance
+}
+
+// NewTemplate creates a Template named name with an instance per params
+func NewTemplate(name string, factory func(Params) Task, params ...Params) *Template {
+	t := &Template{name: name, factory: factory}
+	t.instances, _, _ = t.plan(params)
+	return t
+}
+
+// Name returns the name of the template
+func (t *Template) Name() string {
+	return t.name
+}
+
+// AddTemplate initializes the instances of the template and adds them to
+// the Runner like AddTasks, the instances then follow SetParams
+func (r *Runner) AddTemplate(t *Template) error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.runner != nil {
+		return ErrTemplateAdded
+	}
+	regs := make([]registration, len(t.instances))
+	for i, instance := range t.instances {
+		regs[i] = instance.registration()
+	}
+	handles, err := r.addTasks(regs)
+	if err != nil {
+		return err
+	}
+	for i, instance := range t.instances {
+		instance.handle = handles[i]
+	}
+	t.runner = r
+	return nil
+}
+
+// SetParams replaces the parameter sets of the template. instances whose
+// parameters didn't change are kept, once the template is added the
+// removed ones are removed from the Runner and the new ones are added.
+// if the new ones can't be added the template is left with the kept ones
+// NOTE: once the template is added it blocks until the current iteration
+//
+//	of the loop is complete
+func (t *Template) SetParams(params ...Params) error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	instances, added, removed := t.plan(params)
+	if t.runner == nil {
+		t.instances = instances
+		return nil
+	}
+
+	for _, instance := range removed {
+		t.runner.RemoveTask(instance.handle)
+	}
+	regs := make([]registration, len(added))
+	for i, instance := range added {
+		regs[i] = instance.registration()
+	}
+	handles, err := t.runner.addTasks(regs)
+	if err != nil {
+		t.instances = t.instances[:0:0]
+		for _, instance := range instances {
+			if instance.handle != nil {
+				t.instances = append(t.instances, instance)
+			}
+		}
+		return err
+	}
+	for i, instance := range added {
+		instance.handle = handles[i]
+	}
+	t.instances = instances
+	return nil
+}
+
+// plan returns the instances for params, the ones among them that are new
+// and the current ones that aren't kept. the caller must hold t.mut
+func (t *Template) plan(params []Params) (instances, added, removed []*TemplateInstance) {
+	current := map[string]*TemplateInstance{}
+	for _, instance := range t.instances {
+		current[instance.Params.Suffix] = instance
+	}
+	seen := map[string]bool{}
+	for _, p := range params {
+		if seen[p.Suffix] {
+			continue // the first parameter set with a suffix wins
+		}
+		seen[p.Suffix] = true
+		instance, ok := current[p.Suffix]
+		if ok && reflect.DeepEqual(instance.Params, p) {
+			delete(current, p.Suffix)
+			instances = append(instances, instance)
+			continue
+		}
+		instance = &TemplateInstance{ID: t.name + "/" + p.Suffix, Params: p, task: t.factory(p)}
+		instances = append(instances, instance)
+		added = append(added, instance)
+	}
+	for _, instance := range t.instances {
+		if current[instance.Params.Suffix] == instance {
+			removed = append(removed, instance)
+		}
+	}
+	return instances, added, removed
+}
+
+// Instances returns the current instances of the template
+func (t *Template) Instances() []*TemplateInstance {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return append([]*TemplateInstance(nil), t.instances...)
+}
@@ -0,0 +1,164 @@
+package llamatask
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// regionTask is the task of a template instance
+type regionTask struct {
+	countTask
+	region                string
+	initialized, teardown int32
+}
+
+func (t *regionTask) Initialize() { atomic.AddInt32(&t.initialized, 1) }
+func (t *regionTask) Teardown()   { atomic.AddInt32(&t.teardown, 1) }
+
+func newRegionTemplate(params ...Params) (*Template, map[string]*regionTask) {
+	tasks := map[string]*regionTask{}
+	return NewTemplate("regions", func(p Params) Task {
+		task := &regionTask{region: p.Values["region"]}
+		tasks[p.Suffix] = task
+		return task
+	}, params...), tasks
+}
+
+func taskNames(r *Runner) []string {
+	var names []string
+	for _, h := range r.Tasks() {
+		names = append(names, h.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestTemplateInstancesAreTasks(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	tmpl, tasks := newRegionTemplate(
+		Params{Suffix: "eu", Labels: map[string]string{"region": "eu"}},
+		Params{Suffix: "us", Labels: map[string]string{"region": "us"}},
+	)
+	if err := r.AddTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if got := taskNames(r); len(got) != 2 || got[0] != "regions/eu" || got[1] != "regions/us" {
+		t.Fatalf("tasks = %v, want one per instance", got)
+	}
+	if tasks["eu"].initialized != 1 {
+		t.Errorf("instance wasn't initialized")
+	}
+	if err := r.AddTemplate(tmpl); err != ErrTemplateAdded {
+		t.Errorf("adding the template twice: got %v, want ErrTemplateAdded", err)
+	}
+
+	r.tick(time.Now())
+	for _, e := range r.History() {
+		if e.Task.Labels()["region"] != e.Task.Name()[len("regions/"):] {
+			t.Errorf("execution of %s has labels %v", e.Task.Name(), e.Task.Labels())
+		}
+	}
+	summary := Summarize(r, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if len(summary.Tasks) != 2 || summary.Tasks[0].Labels["region"] != "eu" {
+		t.Errorf("summary = %+v, want the instances with their labels", summary.Tasks)
+	}
+}
+
+func TestTemplateSetParams(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	tmpl, tasks := newRegionTemplate(Params{Suffix: "eu"}, Params{Suffix: "us"}, Params{Suffix: "ap"})
+	if err := r.AddTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	eu, us, ap := tasks["eu"], tasks["us"], tasks["ap"]
+
+	err := tmpl.SetParams(
+		Params{Suffix: "eu"},
+		Params{Suffix: "us", Values: map[string]string{"region": "us-east"}},
+		Params{Suffix: "sa"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := taskNames(r); len(got) != 3 || got[0] != "regions/eu" || got[1] != "regions/sa" || got[2] != "regions/us" {
+		t.Fatalf("tasks = %v", got)
+	}
+	if eu.teardown != 0 || tasks["eu"] != eu {
+		t.Errorf("the unchanged instance was replaced")
+	}
+	if us.teardown != 1 || ap.teardown != 1 {
+		t.Errorf("the changed and removed instances weren't torn down")
+	}
+	if tasks["us"].region != "us-east" || tasks["us"].initialized != 1 || tasks["sa"].initialized != 1 {
+		t.Errorf("the new instances weren't created and initialized")
+	}
+	if len(tmpl.Instances()) != 3 {
+		t.Errorf("%d instances, want 3", len(tmpl.Instances()))
+	}
+}
+
+func TestTemplateOffset(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	tmpl, tasks := newRegionTemplate(Params{Suffix: "now"}, Params{Suffix: "later", Offset: 50 * time.Millisecond})
+	if err := r.AddTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	time.Sleep(10 * time.Millisecond)
+	if tasks["now"].count() != 1 || tasks["later"].count() != 0 {
+		t.Fatalf("runs before the offset: now %d, later %d", tasks["now"].count(), tasks["later"].count())
+	}
+	if _, err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tasks["later"].count() != 1 {
+		t.Errorf("the delayed instance ran %d times, want 1", tasks["later"].count())
+	}
+}
+
+func TestTemplateOffsetSync(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	tmpl, tasks := newRegionTemplate(Params{Suffix: "later", Offset: 300 * time.Millisecond}, Params{Suffix: "now"})
+	if err := r.AddTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	r.tick(start)
+	r.Status()
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("the Runner was locked for %s during the offset", waited)
+	}
+	if tasks["now"].count() != 1 || tasks["later"].count() != 0 {
+		t.Fatalf("runs before the offset: now %d, later %d", tasks["now"].count(), tasks["later"].count())
+	}
+	if _, err := r.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if tasks["later"].count() != 1 {
+		t.Errorf("the delayed instance ran %d times, want 1", tasks["later"].count())
+	}
+}
+
+func TestTemplateOffsetCancelled(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, true)
+	tmpl, tasks := newRegionTemplate(Params{Suffix: "removed", Offset: time.Hour}, Params{Suffix: "stopped", Offset: time.Hour})
+	if err := r.AddTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if err := tmpl.SetParams(Params{Suffix: "stopped", Offset: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	r.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := r.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tasks["removed"].count() != 0 || tasks["stopped"].count() != 0 {
+		t.Errorf("delayed instances ran after being removed or stopped")
+	}
+}
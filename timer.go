@@ -0,0 +1,188 @@
+package llamatask
+
+import (
+	"sync"
+	"time"
+)
+
+// tickSource delivers the ticks of a Runner
+type tickSource interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// timeTicker is a tickSource backed by its own time.Ticker
+type timeTicker struct {
+	t *time.Ticker
+}
+
+func (t timeTicker) C() <-chan time.Time   { return t.t.C }
+func (t timeTicker) Reset(d time.Duration) { t.t.Reset(d) }
+func (t timeTicker) Stop()                 { t.t.Stop() }
+
+// TimerService delivers the ticks of many runners from a single goroutine.
+// the goroutine only runs while at least one Runner is attached to it
+type TimerService struct {
+	mut     sync.Mutex
+	subs    map[*subscription]struct{}
+	wake    chan struct{}
+	frozen  bool
+	running bool
+}
+
+// SharedTimer is the process-wide TimerService
+var SharedTimer = NewTimerService()
+
+// NewTimerService initializes a new TimerService
+func NewTimerService() *TimerService {
+	return &TimerService{
+		subs: map[*subscription]struct{}{},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// NewRunnerWithTimer initializes a new Runner that gets its ticks from s
+// instead of its own time.Ticker
+func NewRunnerWithTimer(s *TimerService, interval time.Duration, shouldRunOnGoroutines bool) Runner {
+	return newRunner(s.subscribe(interval), interval, shouldRunOnGoroutines)
+}
+
+// Freeze stops delivering ticks to every attached Runner until Unfreeze
+func (s *TimerService) Freeze() {
+	s.mut.Lock()
+	s.frozen = true
+	s.mut.Unlock()
+	s.poke()
+}
+
+// Unfreeze resumes delivering ticks, the next tick of every Runner is a
+// full interval from now
+func (s *TimerService) Unfreeze() {
+	s.mut.Lock()
+	s.frozen = false
+	now := time.Now()
+	for sub := range s.subs {
+		sub.next = now.Add(sub.interval)
+	}
+	s.mut.Unlock()
+	s.poke()
+}
+
+// Tick delivers a tick to every attached Runner right away, even when frozen
+func (s *TimerService) Tick() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	now := time.Now()
+	for sub := range s.subs {
+		sub.send(now)
+	}
+}
+
+func (s *TimerService) subscribe(interval time.Duration) *subscription {
+	sub := &subscription{
+		svc:      s,
+		c:        make(chan time.Time, 1),
+		interval: interval,
+		next:     time.Now().Add(interval),
+	}
+	s.mut.Lock()
+	s.subs[sub] = struct{}{}
+	if !s.running {
+		s.running = true
+		go s.loop()
+	}
+	s.mut.Unlock()
+	s.poke()
+	return sub
+}
+
+// poke wakes up the timer goroutine so it recomputes the next tick
+func (s *TimerService) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop is the timer goroutine, it sleeps until the earliest tick among the
+// attached runners and delivers every tick that is due
+func (s *TimerService) loop() {
+	for {
+		s.mut.Lock()
+		if len(s.subs) == 0 {
+			s.running = false
+			s.mut.Unlock()
+			return
+		}
+		next := s.deliver(time.Now())
+		s.mut.Unlock()
+
+		if next.IsZero() {
+			<-s.wake
+			continue
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// deliver sends the ticks that are due at now and returns when the next
+// one is, or the zero time while frozen. the caller must hold s.mut
+func (s *TimerService) deliver(now time.Time) time.Time {
+	var next time.Time
+	if s.frozen {
+		return next
+	}
+	for sub := range s.subs {
+		if !sub.next.After(now) {
+			sub.send(now)
+			// like time.Ticker, drop the ticks we are late for
+			missed := now.Sub(sub.next)/sub.interval + 1
+			sub.next = sub.next.Add(missed * sub.interval)
+		}
+		if next.IsZero() || sub.next.Before(next) {
+			next = sub.next
+		}
+	}
+	return next
+}
+
+// subscription is the tickSource of a Runner attached to a TimerService
+type subscription struct {
+	svc      *TimerService
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+func (sub *subscription) C() <-chan time.Time {
+	return sub.c
+}
+
+func (sub *subscription) Reset(d time.Duration) {
+	sub.svc.mut.Lock()
+	sub.interval = d
+	sub.next = time.Now().Add(d)
+	sub.svc.mut.Unlock()
+	sub.svc.poke()
+}
+
+func (sub *subscription) Stop() {
+	sub.svc.mut.Lock()
+	delete(sub.svc.subs, sub)
+	sub.svc.mut.Unlock()
+	sub.svc.poke()
+}
+
+// send delivers a tick without blocking, the caller must hold svc.mut
+func (sub *subscription) send(now time.Time) {
+	select {
+	case sub.c <- now:
+	default:
+	}
+}
@@ -0,0 +1,151 @@
+package llamatask
+
+import (
+	"testing"
+	"time"
+)
+
+// attach adds a subscription due at next to s without starting its goroutine
+func attach(s *TimerService, interval time.Duration, next time.Time) *subscription {
+	sub := &subscription{svc: s, c: make(chan time.Time, 1), interval: interval, next: next}
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// received returns the tick waiting on sub, if any
+func received(sub *subscription) (time.Time, bool) {
+	select {
+	case tick := <-sub.c:
+		return tick, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestTimerServiceDeliver(t *testing.T) {
+	s := NewTimerService()
+	minutely := attach(s, time.Minute, clockBase.Add(time.Minute))
+	hourly := attach(s, time.Hour, clockBase.Add(time.Hour))
+
+	if next := s.deliver(clockBase); !next.Equal(clockBase.Add(time.Minute)) {
+		t.Errorf("next = %s, want the earliest tick", next)
+	}
+	if _, ok := received(minutely); ok {
+		t.Error("a tick was delivered early")
+	}
+
+	now := clockBase.Add(time.Minute)
+	s.deliver(now)
+	if tick, ok := received(minutely); !ok || !tick.Equal(now) {
+		t.Errorf("got tick %s, %v; want the due tick", tick, ok)
+	}
+	if _, ok := received(hourly); ok {
+		t.Error("the tick of another runner was delivered early")
+	}
+}
+
+func TestTimerServiceDropsLateTicks(t *testing.T) {
+	s := NewTimerService()
+	sub := attach(s, time.Minute, clockBase.Add(time.Minute))
+
+	// 3.5 intervals late: one tick is delivered and the missed ones dropped
+	now := clockBase.Add(4*time.Minute + 30*time.Second)
+	next := s.deliver(now)
+	if want := clockBase.Add(5 * time.Minute); !next.Equal(want) || !sub.next.Equal(want) {
+		t.Errorf("next = %s, want %s", next, want)
+	}
+	if _, ok := received(sub); !ok {
+		t.Fatal("the late tick wasn't delivered")
+	}
+	s.deliver(now)
+	if _, ok := received(sub); ok {
+		t.Error("a dropped tick was delivered")
+	}
+
+	// exactly on time
+	s.deliver(clockBase.Add(5 * time.Minute))
+	if !sub.next.Equal(clockBase.Add(6 * time.Minute)) {
+		t.Errorf("next = %s after an on-time tick", sub.next)
+	}
+}
+
+func TestTimerServiceFreeze(t *testing.T) {
+	s := NewTimerService()
+	sub := attach(s, time.Minute, clockBase)
+
+	s.Freeze()
+	if next := s.deliver(clockBase.Add(time.Hour)); !next.IsZero() {
+		t.Errorf("next = %s while frozen, want none", next)
+	}
+	if _, ok := received(sub); ok {
+		t.Error("a tick was delivered while frozen")
+	}
+
+	// Tick delivers even when frozen
+	s.Tick()
+	if _, ok := received(sub); !ok {
+		t.Error("Tick didn't deliver")
+	}
+
+	before := time.Now()
+	s.Unfreeze()
+	if sub.next.Before(before.Add(time.Minute)) {
+		t.Errorf("next = %s after Unfreeze, want a full interval from now", sub.next)
+	}
+}
+
+func TestTimerServiceGoroutine(t *testing.T) {
+	s := NewTimerService()
+	running := func() bool {
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		return s.running
+	}
+	first := NewRunnerWithTimer(s, time.Hour, false)
+	second := NewRunnerWithTimer(s, time.Hour, false)
+	if !running() {
+		t.Fatal("the goroutine didn't start")
+	}
+
+	first.Stop()
+	time.Sleep(10 * time.Millisecond)
+	if !running() {
+		t.Fatal("the goroutine exited while a runner is attached")
+	}
+	second.Stop()
+	waitFor(t, "the goroutine to exit", func() bool { return !running() })
+
+	// it starts again for the next runner
+	third := NewRunnerWithTimer(s, time.Hour, false)
+	defer third.Stop()
+	if !running() {
+		t.Error("the goroutine didn't restart")
+	}
+}
+
+func TestTimerServiceTicksRunner(t *testing.T) {
+	s := NewTimerService()
+	r := NewRunnerWithTimer(s, 10*time.Millisecond, false)
+	task := &countTask{}
+	r.AddTask(task)
+	r.RunAsync()
+	defer r.Stop()
+	waitFor(t, "the runner to tick", func() bool { return task.count() >= 2 })
+}
+
+func TestTimerServiceResetAfterClockJump(t *testing.T) {
+	s := NewTimerService()
+	r := NewRunnerWithTimer(s, time.Minute, false)
+	defer r.Stop()
+	r.elapsed = func(last, now time.Time) time.Duration { return time.Minute }
+	sub := r.ticker.(*subscription)
+
+	r.tick(clockBase)
+	before := time.Now()
+	r.tick(clockBase.Add(2 * time.Hour))
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if sub.next.Before(before.Add(time.Minute)) {
+		t.Errorf("next = %s after the jump, want a full interval from now", sub.next)
+	}
+}
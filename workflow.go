@@ -0,0 +1,236 @@
+package llamatask
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrSignalTimeout is returned by a Workflow whose signal didn't come in time
+var ErrSignalTimeout = errors.New("llamatask: timed out waiting for signal")
+
+// WorkflowStep is a step of a Workflow
+type WorkflowStep struct {
+	do      func() error
+	sleep   time.Duration
+	signal  string
+	timeout time.Duration
+}
+
+// Do is a step that runs fn, the step is retried on the next tick until
+// fn succeeds. the error of fn is returned by the workflow as a transient
+// error, unless fn marked it with Permanent
+func Do(fn func() error) WorkflowStep {
+	return WorkflowStep{do: fn}
+}
+
+// Sleep is a step that waits for d, the deadline is persisted so the sleep
+// survives restarts
+func Sleep(d time.Duration) WorkflowStep {
+	return WorkflowStep{sleep: d}
+}
+
+// WaitForSignal is a step that waits until the signal is sent with
+// SendSignal, the signal is consumed by the step. if it doesn't come within
+// timeout (zero waits forever) the workflow fails permanently with
+// ErrSignalTimeout
+func WaitForSignal(name string, timeout time.Duration) WorkflowStep {
+	return WorkflowStep{signal: name, timeout: timeout}
+}
+
+// Workflow is a task that runs its steps in order, advancing on each tick
+// as far as it can. its progress is kept in its State, so it resumes where
+// it was after a restart as long as the JobStore is durable. a step is
+// complete once the next step number is written, what it wrote before is
+// keyed by its number so a restart in between doesn't lose it.
+// the name identifies the workflow in the JobStore and in SendSignal
+type Workflow struct {
+	name  string
+	steps []WorkflowStep
+	state *State
+}
+
+// NewWorkflow creates a Workflow
+func NewWorkflow(name string, steps ...WorkflowStep) *Workflow {
+	return &Workflow{name: name, steps: steps}
+}
+
+// Name returns the name of the workflow
+func (w *Workflow) Name() string {
+	return w.name
+}
+
+// UseState sets the state the progress is kept in
+func (w *Workflow) UseState(s *State) {
+	w.state = s
+}
+
+// Step returns the index of the current step, it's the number of steps
+// once the workflow is done
+func (w *Workflow) Step() (int, error) {
+	step, err := w.getInt("step")
+	return int(step), err
+}
+
+// Done reports whether every step completed
+func (w *Workflow) Done() (bool, error) {
+	step, err := w.Step()
+	return step >= len(w.steps), err
+}
+
+// Signal returns the payload of the last signal consumed by a
+// WaitForSignal step of the workflow
+func (w *Workflow) Signal(name string) ([]byte, bool, error) {
+	received, ok, err := getSignal(w.state, "received/"+name)
+	return received.Payload, ok, err
+}
+
+// Run advances the workflow until it has to wait or it's done
+func (w *Workflow) Run() error {
+	for {
+		step, err := w.Step()
+		if err != nil || step >= len(w.steps) {
+			return err
+		}
+		done, err := w.runStep(step, w.steps[step])
+		if err != nil || !done {
+			return err
+		}
+		if err := w.state.Set("step", []byte(strconv.Itoa(step+1))); err != nil {
+			return err
+		}
+		// a restart before this only leaves the deadline behind
+		if err := w.state.Delete(untilKey(step)); err != nil {
+			return err
+		}
+	}
+}
+
+// runStep runs the step at index step once and reports whether it's complete
+func (w *Workflow) runStep(step int, s WorkflowStep) (bool, error) {
+	switch {
+	case s.do != nil:
+		if err := s.do(); err != nil {
+			return false, Transient(err)
+		}
+		return true, nil
+	case s.signal != "":
+		if ok, err := w.consume(step, s.signal); err != nil || ok {
+			return ok, err
+		}
+		if s.timeout <= 0 {
+			return false, nil
+		}
+		expired, err := w.deadline(step, s.timeout)
+		if err == nil && expired {
+			err = Permanent(ErrSignalTimeout)
+		}
+		return false, err
+	default:
+		return w.deadline(step, s.sleep)
+	}
+}
+
+// signal is a signal as it's kept in the store. Seq counts the signals
+// sent, Step is the step that received it
+type signal struct {
+	Seq     int64  `json:"seq"`
+	Step    int    `json:"step"`
+	Payload []byte `json:"payload"`
+}
+
+func getSignal(s *State, key string) (signal, bool, error) {
+	var sig signal
+	value, ok, err := s.Get(key)
+	if err != nil || !ok {
+		return sig, false, err
+	}
+	return sig, true, json.Unmarshal(value, &sig)
+}
+
+// consume receives the signal sent since the last one received, it reports
+// whether the step at index step got it. the pending signal is kept, it's
+// pending as long as it's newer than the received one
+func (w *Workflow) consume(step int, name string) (bool, error) {
+	received, ok, err := getSignal(w.state, "received/"+name)
+	if err != nil {
+		return false, err
+	}
+	if ok && received.Step == step {
+		// received before a restart, the step wasn't completed yet
+		return true, nil
+	}
+	sent, pending, err := getSignal(w.state, "signal/"+name)
+	if err != nil || !pending || sent.Seq <= received.Seq {
+		return false, err
+	}
+	sent.Step = step
+	value, err := json.Marshal(sent)
+	if err != nil {
+		return false, err
+	}
+	return true, w.state.Set("received/"+name, value)
+}
+
+func untilKey(step int) string {
+	return "until/" + strconv.Itoa(step)
+}
+
+// deadline reports whether d passed since the step at index step started
+// waiting
+func (w *Workflow) deadline(step int, d time.Duration) (bool, error) {
+	until, err := w.getInt(untilKey(step))
+	if err != nil {
+		return false, err
+	}
+	if until == 0 {
+		return false, w.state.Set(untilKey(step), []byte(strconv.FormatInt(time.Now().Add(d).UnixNano(), 10)))
+	}
+	return time.Now().UnixNano() >= until, nil
+}
+
+func (w *Workflow) getInt(key string) (int64, error) {
+	value, ok, err := w.state.Get(key)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+// SendSignal sends a signal with its payload to the named workflow through
+// the store, a workflow waiting for it resumes on its next tick. a signal
+// that wasn't received yet is replaced
+func SendSignal(store JobStore, workflow, name string, payload []byte) error {
+	state := taskState(store, workflow)
+	for {
+		old, ok, err := state.Get("signal/" + name)
+		if err != nil {
+			return err
+		}
+		var sent signal
+		if ok {
+			if err := json.Unmarshal(old, &sent); err != nil {
+				return err
+			}
+		} else {
+			old = nil
+		}
+		value, err := json.Marshal(signal{Seq: sent.Seq + 1, Payload: payload})
+		if err != nil {
+			return err
+		}
+		if swapped, err := state.CompareAndSet("signal/"+name, old, value); err != nil || swapped {
+			return err
+		}
+	}
+}
+
+// SendSignal sends a signal to a workflow using the JobStore of the Runner
+// NOTE: it blocks until the current iteration of the loop is complete
+func (r *Runner) SendSignal(workflow, name string, payload []byte) error {
+	r.mut.Lock()
+	store := r.store
+	r.mut.Unlock()
+	return SendSignal(store, workflow, name, payload)
+}
@@ -0,0 +1,170 @@
+package llamatask
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkflowDoReturnsError(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	errFlaky := errors.New("flaky")
+	calls := 0
+	wf := NewWorkflow("import", Do(func() error {
+		if calls++; calls < 3 {
+			return errFlaky
+		}
+		return nil
+	}))
+	r.AddTask(wf)
+
+	r.tick(time.Now())
+	if e := r.History()[0]; e.Outcome != OutcomeFailed || !errors.Is(e.Err, errFlaky) || IsPermanent(e.Err) {
+		t.Fatalf("got %s execution with %v, want the transient error of the step", e.Outcome, e.Err)
+	}
+	r.SetRetries(1)
+	r.tick(time.Now())
+	if e := r.History()[1]; e.Outcome != OutcomeCompleted || e.Attempts != 2 {
+		t.Errorf("got %s execution after %d attempts, want the failed step retried", e.Outcome, e.Attempts)
+	}
+	if done, _ := wf.Done(); !done {
+		t.Error("the workflow isn't done")
+	}
+}
+
+func TestWorkflowDoPermanent(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	errInvalid := errors.New("invalid")
+	h := r.AddTask(NewWorkflow("import", Do(func() error { return Permanent(errInvalid) })))
+
+	r.tick(time.Now())
+	if err := h.DeadLetter(); !errors.Is(err, errInvalid) {
+		t.Errorf("got dead letter %v, want the permanent error of the step", err)
+	}
+}
+
+func TestWorkflowConsumesSignals(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	var payloads []string
+	var wf *Workflow
+	record := Do(func() error {
+		payload, _, err := wf.Signal("approved")
+		payloads = append(payloads, string(payload))
+		return err
+	})
+	wf = NewWorkflow("deploy", WaitForSignal("approved", 0), record, WaitForSignal("approved", 0), record)
+	r.AddTask(wf)
+
+	if err := r.SendSignal("deploy", "approved", []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	r.tick(time.Now())
+	if step, _ := wf.Step(); step != 2 {
+		t.Fatalf("at step %d, want the second signal to wait", step)
+	}
+	r.tick(time.Now())
+	if step, _ := wf.Step(); step != 2 || len(payloads) != 1 {
+		t.Error("the consumed signal was received again")
+	}
+
+	r.SendSignal("deploy", "approved", []byte("bob"))
+	r.tick(time.Now())
+	if done, _ := wf.Done(); !done || len(payloads) != 2 || payloads[0] != "alice" || payloads[1] != "bob" {
+		t.Errorf("done %v with payloads %q", done, payloads)
+	}
+}
+
+func TestWorkflowSignalTimeout(t *testing.T) {
+	r, _ := newTestRunner(time.Minute, false)
+	h := r.AddTask(NewWorkflow("deploy", WaitForSignal("approved", time.Nanosecond)))
+
+	r.tick(time.Now()) // starts waiting
+	time.Sleep(time.Millisecond)
+	r.tick(time.Now())
+	if err := h.DeadLetter(); !errors.Is(err, ErrSignalTimeout) {
+		t.Errorf("got dead letter %v, want ErrSignalTimeout", err)
+	}
+}
+
+func TestWorkflowResumes(t *testing.T) {
+	store := NewMemoryStore()
+	ran := 0
+	newWorkflow := func() *Workflow {
+		return NewWorkflow("report", Do(func() error { ran++; return nil }), Sleep(time.Hour), Do(func() error { ran++; return nil }))
+	}
+	r, _ := newTestRunner(time.Minute, false)
+	r.SetJobStore(store)
+	r.AddTask(newWorkflow())
+	r.tick(time.Now())
+
+	// the restarted workflow is still sleeping
+	restarted, _ := newTestRunner(time.Minute, false)
+	restarted.SetJobStore(store)
+	wf := newWorkflow()
+	restarted.AddTask(wf)
+	restarted.tick(time.Now())
+	if step, _ := wf.Step(); step != 1 || ran != 1 {
+		t.Errorf("at step %d after %d runs, want the sleep to resume", step, ran)
+	}
+}
+
+// crashingStore is a JobStore whose writes of the keys ending with crashOn
+// fail while it's set, like a process dying before them
+type crashingStore struct {
+	JobStore
+	crashOn string
+}
+
+var errCrashed = errors.New("crashed")
+
+func (s *crashingStore) Set(key string, value []byte) error {
+	if s.crashOn != "" && strings.HasSuffix(key, s.crashOn) {
+		return errCrashed
+	}
+	return s.JobStore.Set(key, value)
+}
+
+func TestWorkflowRestartBeforeAdvancing(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		step WorkflowStep
+	}{
+		{"sleep", Sleep(10 * time.Millisecond)},
+		{"signal", WaitForSignal("approved", 0)},
+	} {
+		store := &crashingStore{JobStore: NewMemoryStore()}
+		ran := 0
+		newWorkflow := func() *Workflow {
+			return NewWorkflow("deploy", c.step, Do(func() error { ran++; return nil }))
+		}
+		r, _ := newTestRunner(time.Minute, false)
+		r.SetJobStore(store)
+		r.AddTask(newWorkflow())
+		r.tick(time.Now())
+		time.Sleep(20 * time.Millisecond)
+		r.SendSignal("deploy", "approved", []byte("alice"))
+
+		// the step is complete but the process dies before advancing
+		store.crashOn = "/step"
+		r.tick(time.Now())
+		if e := r.History()[1]; !errors.Is(e.Err, errCrashed) {
+			t.Fatalf("%s: got %v, want the crash", c.name, e.Err)
+		}
+
+		store.crashOn = ""
+		restarted, _ := newTestRunner(time.Minute, false)
+		restarted.SetJobStore(store)
+		wf := newWorkflow()
+		restarted.AddTask(wf)
+		restarted.tick(time.Now())
+		if done, _ := wf.Done(); !done || ran != 1 {
+			t.Errorf("%s: the completed step didn't survive the restart", c.name)
+		}
+		if c.name == "signal" {
+			if payload, _, _ := wf.Signal("approved"); string(payload) != "alice" {
+				t.Errorf("got payload %q, want the signal received before the restart", payload)
+			}
+		}
+	}
+}